@@ -43,6 +43,10 @@ var clientCmd = &cobra.Command{
 			b, _, _ := reader.ReadLine()
 			str := string(b)
 			fmt.Fprintln(conn, str)
+			if isWatch(str) {
+				watch(conn, scanner, reader)
+				continue
+			}
 			ok := scanner.Scan()
 
 			if !ok {
@@ -62,6 +66,13 @@ func execCommands(conn *net.Conn) {
 
 	for _, cmd := range cmds {
 		fmt.Fprintln(*conn, cmd)
+		if isWatch(cmd) {
+			// Streams until the connection is closed
+			for scanner.Scan() {
+				fmt.Println(scanner.Text())
+			}
+			return
+		}
 		ok := scanner.Scan()
 		start := time.Now().Unix()
 		for !ok {
@@ -74,6 +85,31 @@ func execCommands(conn *net.Conn) {
 	}
 }
 
+// watchEnd is sent by the server once a watch is over
+const watchEnd = "stopped watching"
+
+func isWatch(cmd string) bool {
+	return strings.ToLower(strings.SplitN(cmd, " ", 2)[0]) == "watch"
+}
+
+// watch prints events pushed by the server until the user presses enter
+func watch(conn net.Conn, scanner *bufio.Scanner, reader *bufio.Reader) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for scanner.Scan() {
+			fmt.Println(scanner.Text())
+			if scanner.Text() == watchEnd {
+				return
+			}
+		}
+	}()
+
+	_, _, _ = reader.ReadLine()
+	fmt.Fprintln(conn)
+	<-done
+}
+
 func init() {
 	rootCmd.AddCommand(clientCmd)
 
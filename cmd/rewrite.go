@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/write"
+	"github.com/spf13/cobra"
+)
+
+// rewriteCmd represents the rewrite command
+var rewriteCmd = &cobra.Command{
+	Use:   "rewrite",
+	Short: "Compact an append-only file",
+	Long: `Compacts the append-only file of the database at location (location + .aof) while no server is running.
+	Every key is written once with it's latest value. To compact the log of a running server send it the 'rewrite' TCP command or POST /admin/rewrite over HTTP`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if location == "" {
+			log.Fatalln("location is required")
+		}
+
+		errChan := make(chan error, 10)
+		db := database.New(location, false, false, errChan, make(chan bool), 0, database.WithAppendOnly(write.FsyncAlways))
+		if err := db.Connect(); err != nil {
+			log.Fatalln(err)
+		}
+		if err := db.RewriteLog(); err != nil {
+			log.Fatalln("Rewrite failed:", err)
+		}
+		if err := db.Disconnect(); err != nil {
+			log.Fatalln("Dirty shutdown:", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rewriteCmd)
+
+	rewriteCmd.Flags().StringVarP(&location, "location", "l", "", "Location of the database file")
+}
@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"strings"
 
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/engine"
+	"github.com/maracko/go-store/database/write"
 	"github.com/spf13/cobra"
 )
 
@@ -49,6 +54,16 @@ var location string
 var memory bool
 var continousWrite bool
 var writeInt int
+var appendOnly bool
+var fsync string
+var rewriteMinSize int64
+var rewriteGrowth int
+var backups int
+var engineName string
+var shards int
+var segments int
+var maxMemory int64
+var evictionPolicy string
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
@@ -60,5 +75,46 @@ func init() {
 	serverCmd.PersistentFlags().BoolVarP(&memory, "memory", "m", false, "If present values won't be saved upon exit (Has no effect if location is empty)")
 	serverCmd.PersistentFlags().BoolVarP(&continousWrite, "continous-write", "c", false, "Keep writing data to file to disk concurrently")
 	serverCmd.PersistentFlags().IntVarP(&writeInt, "write-interval", "i", 0, "Continous writes occur only once every i minutes (last write is always saved). Default is 1")
+	serverCmd.PersistentFlags().StringVar(&engineName, "engine", engine.Default, fmt.Sprintf("Storage engine holding the data, one of: %s", strings.Join(engine.Names(), ", ")))
+	serverCmd.PersistentFlags().IntVar(&shards, "shards", database.DefaultShards, "Number of shards keys are split into, each locked separately so operations on different keys run in parallel")
+	serverCmd.PersistentFlags().IntVar(&segments, "segments", database.DefaultSegments, "Number of segment files keys of a new database file are split into, only segments with changed keys are rewritten")
+	serverCmd.PersistentFlags().IntVar(&backups, "backups", 1, "Number of previous database files to keep as location.1, location.2... used if the newest one is corrupt")
+	serverCmd.PersistentFlags().BoolVarP(&appendOnly, "append-only", "a", false, "Log every change to an append-only file (location + .aof) instead of writing snapshots")
+	serverCmd.PersistentFlags().StringVar(&fsync, "fsync", string(write.FsyncEverySec), "How often the append-only file is synced to disk: always, everysec or no")
+	serverCmd.PersistentFlags().Int64Var(&rewriteMinSize, "rewrite-min-size", write.DefaultRewriteMinSize>>20, "Size in MB the append-only file must reach before it's automatically compacted")
+	serverCmd.PersistentFlags().IntVar(&rewriteGrowth, "rewrite-percentage", write.DefaultRewriteGrowth, "How many percent the append-only file must grow since the last compaction to be compacted again. 0 disables automatic compaction")
+	serverCmd.PersistentFlags().Int64Var(&maxMemory, "max-memory", 0, "Approximate size in MB keys and values of each namespace may use before keys are evicted. 0 means no limit")
+	serverCmd.PersistentFlags().StringVar(&evictionPolicy, "eviction-policy", string(database.NoEviction), "Which keys are evicted over the memory limit: noeviction, allkeys-lru, allkeys-lfu, allkeys-random, volatile-lru, volatile-lfu, volatile-random or volatile-ttl")
 
 }
+
+// newRegistry creates the namespace registry, each namespace is opened with the server flags
+func newRegistry(errChan chan error) *database.Registry {
+	return database.NewRegistry(location, func(l string) *database.DB {
+		return database.New(l, memory, continousWrite, errChan, make(chan bool), writeInt, dbOptions()...)
+	})
+}
+
+// dbOptions builds database options from the server flags
+func dbOptions() []database.Option {
+	factory, err := engine.Factory(engineName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	opts := []database.Option{database.WithEngine(factory), database.WithShards(shards), database.WithSegments(segments), database.WithBackups(backups)}
+	if appendOnly {
+		policy, err := write.ParseFsyncPolicy(fsync)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts = append(opts, database.WithAppendOnly(policy), database.WithLogRewrite(rewriteMinSize<<20, rewriteGrowth))
+	}
+	if maxMemory > 0 {
+		policy, err := database.ParseEvictionPolicy(evictionPolicy)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts = append(opts, database.WithMaxMemory(maxMemory<<20, policy))
+	}
+	return opts
+}
@@ -7,7 +7,6 @@ import (
 	"sync"
 	"syscall"
 
-	"github.com/maracko/go-store/database"
 	"github.com/maracko/go-store/server/http"
 	"github.com/spf13/cobra"
 )
@@ -23,7 +22,6 @@ var serveHTTPCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		// create the server
 		errChan := make(chan error, 5)
-		writeSvcDone := make(chan bool)
 		srvDone := &sync.WaitGroup{}
 		done := make(chan os.Signal, 1)
 
@@ -33,7 +31,7 @@ var serveHTTPCmd = &cobra.Command{
 			token,
 			pKey,
 			cert,
-			database.New(location, memory, continousWrite, errChan, writeSvcDone, writeInt),
+			newRegistry(errChan),
 			srvDone,
 		)
 
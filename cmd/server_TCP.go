@@ -6,7 +6,6 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/maracko/go-store/database"
 	"github.com/maracko/go-store/server/tcp"
 	"github.com/spf13/cobra"
 )
@@ -23,12 +22,11 @@ var serveTCPCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		// create the server
 		errChan := make(chan error, 10)
-		writeDone := make(chan bool)
 		done := make(chan os.Signal, 1)
 
 		s := tcp.New(
 			port,
-			database.New(location, memory, continousWrite, errChan, writeDone, writeInt),
+			newRegistry(errChan),
 		)
 
 		// Route shutdown signals to done channel
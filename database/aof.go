@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/maracko/go-store/database/engine"
+	"github.com/maracko/go-store/database/write"
+)
+
+// loadLog replays the append-only log and opens it for appending.
+// If the log is empty it is seeded from the snapshot at d.location
+func (d *DB) loadLog() error {
+	n, err := d.writeService.ReplayLog(d.apply)
+	if err != nil {
+		return errors.New("cannot replay log: " + err.Error())
+	}
+	log.Printf("Replayed %d records from %s", n, d.writeService.LogPath())
+
+	if n == 0 {
+		snap, err := d.readSnapshot()
+		if err != nil {
+			return err
+		}
+		d.load(snap)
+	}
+
+	if d.memory {
+		return nil
+	}
+	if err := d.writeService.OpenLog(d.fsync); err != nil {
+		return errors.New("cannot open log: " + err.Error())
+	}
+	if n == 0 && (d.len() > 0 || len(d.indexes) > 0) {
+		defer d.lockAll()()
+		if err := d.writeService.Append(d.indexRecords()...); err != nil {
+			return errors.New("cannot log indexes: " + err.Error())
+		}
+		keys := make([]string, 0, d.len())
+		for _, s := range d.shards {
+			s.data.Iterate(func(k string, _ interface{}) bool {
+				keys = append(keys, k)
+				return true
+			})
+		}
+		d.logKeys(keys...)
+	}
+	return nil
+}
+
+// apply applies a replayed log record to the database
+func (d *DB) apply(r *write.Record) {
+	switch r.Op {
+	case write.OpSet:
+		d.put(r.Key, restoreType(r.Key, r.Type, r.Value))
+		d.restoreVersion(r.Key, r.Version)
+		if r.Expires != nil {
+			d.shardOf(r.Key).expires.Put(r.Key, *r.Expires)
+		} else {
+			d.shardOf(r.Key).expires.Delete(r.Key)
+		}
+	case write.OpDel:
+		d.remove(r.Key)
+	case write.OpIndex:
+		d.applyIndex(r)
+	case write.OpDropIndex:
+		delete(d.indexes, r.Key)
+	default:
+		log.Printf("Skipping unknown log record %q for key %s", r.Op, r.Key)
+	}
+}
+
+// logKeys appends the current state of keys to the log. Caller must lock keys
+func (d *DB) logKeys(keys ...string) {
+	recs := make([]*write.Record, 0, len(keys))
+	for _, k := range keys {
+		s := d.shardOf(k)
+		if v, ok := s.data.Get(k); ok {
+			recs = append(recs, setRecord(k, v, s.expires, s.versions))
+		} else {
+			recs = append(recs, write.NewDelRecord(k))
+		}
+	}
+	if err := d.writeService.Append(recs...); err != nil {
+		go func() { d.errChan <- err }()
+		return
+	}
+	if d.writeService.ShouldRewrite() {
+		// the rewrite locks all keys, so it's started once the caller unlocks them
+		go func() {
+			if err := d.BackgroundRewriteLog(); err != nil && err != write.ErrRewriteInProgress {
+				d.errChan <- err
+			}
+		}()
+	}
+}
+
+// RewriteLog compacts the append-only log to one record per live key and waits until it's done.
+// Changes made during the rewrite are carried over to the new log
+func (d *DB) RewriteLog() error {
+	unlock := d.rlockAll()
+	s, err := d.beginRewrite()
+	unlock()
+	if err != nil {
+		return err
+	}
+	return d.writeService.Rewrite(s.records())
+}
+
+// BackgroundRewriteLog starts compacting the append-only log and returns immediately.
+// Errors from the rewrite itself are sent to the error channel
+func (d *DB) BackgroundRewriteLog() error {
+	unlock := d.rlockAll()
+	s, err := d.beginRewrite()
+	unlock()
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := d.writeService.Rewrite(s.records()); err != nil {
+			d.errChan <- err
+		}
+	}()
+	return nil
+}
+
+// beginRewrite captures the current state to be rewritten, it's records can be built without holding any locks.
+// Caller must lock all keys, at least for reading, so nothing is logged while it's captured
+func (d *DB) beginRewrite() (*state, error) {
+	if !d.appendOnly || d.memory || d.location == "" {
+		return nil, errors.New("append-only log is not enabled")
+	}
+	if err := d.writeService.BeginRewrite(); err != nil {
+		return nil, err
+	}
+
+	return d.state(), nil
+}
+
+// setRecord returns a log record storing key with value and it's expiry and version
+func setRecord(key string, value interface{}, expires, versions *engine.HAMT) *write.Record {
+	var exp time.Time
+	if e, ok := expires.Get(key); ok {
+		exp = e.(time.Time)
+	}
+	r := write.NewSetRecord(key, value, exp, version(versions, key))
+	r.Type = typeOf(value)
+	return r
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrNotInteger is returned when incrementing a key or field which doesn't hold an integer
+var ErrNotInteger = errors.New("value is not an integer")
+
+// ErrNotNumber is returned when incrementing a key which doesn't hold a number
+var ErrNotNumber = errors.New("value is not a number")
+
+// Incr adds 1 to the integer at key and returns the result. A missing key counts as 0
+func (d *DB) Incr(key string) (int64, error) {
+	return d.IncrBy(key, 1)
+}
+
+// Decr subtracts 1 from the integer at key and returns the result. A missing key counts as 0
+func (d *DB) Decr(key string) (int64, error) {
+	return d.IncrBy(key, -1)
+}
+
+// DecrBy subtracts delta from the integer at key and returns the result. A missing key counts as 0
+func (d *DB) DecrBy(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, fmt.Errorf("decrement would overflow %s", key)
+	}
+	return d.IncrBy(key, -delta)
+}
+
+// IncrBy adds delta to the integer at key and returns the result. A missing key counts as 0.
+// Integers stored as whole JSON numbers or numeric strings can be incremented too
+func (d *DB) IncrBy(key string, delta int64) (int64, error) {
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+
+	var n int64
+	v, ok := d.lookup(key)
+	if ok {
+		if typeOf(v) != "" {
+			return 0, ErrWrongType
+		}
+		if n, ok = toInt(v); !ok {
+			return 0, fmt.Errorf("%s: %w", key, ErrNotInteger)
+		}
+	} else {
+		d.setExpiry(key, 0)
+	}
+
+	res, ok := addInt(n, delta)
+	if !ok {
+		return 0, fmt.Errorf("increment would overflow %s", key)
+	}
+	d.put(key, res)
+	d.changed(key)
+	return res, nil
+}
+
+// IncrByFloat adds delta to the number at key and returns the result, which is stored as a float. A missing key counts as 0
+func (d *DB) IncrByFloat(key string, delta float64) (float64, error) {
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+
+	var n float64
+	v, ok := d.lookup(key)
+	if ok {
+		if typeOf(v) != "" {
+			return 0, ErrWrongType
+		}
+		if n, ok = toFloat(v); !ok {
+			return 0, fmt.Errorf("%s: %w", key, ErrNotNumber)
+		}
+	} else {
+		d.setExpiry(key, 0)
+	}
+
+	res := n + delta
+	if math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, fmt.Errorf("increment would make %s infinite", key)
+	}
+	d.put(key, res)
+	d.changed(key)
+	return res, nil
+}
+
+// addInt returns n + delta and false if it overflows
+func addInt(n, delta int64) (int64, bool) {
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, false
+	}
+	return n + delta, true
+}
+
+// toInt converts integers, whole floats decoded from JSON and numeric strings to an int64
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// toFloat converts numbers and numeric strings to a finite float64
+func toFloat(v interface{}) (float64, bool) {
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case int64:
+		f = float64(n)
+	case int:
+		f = float64(n)
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(n, 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// CursorStart is the cursor which starts a new scan, it's also returned once a scan is complete
+const CursorStart = "0"
+
+// DefaultCursorCount is the number of keys examined per ScanCursor call when count isn't set
+const DefaultCursorCount = 10
+
+// ScanCursor returns the next page of keys matching the glob pattern match, starting after cursor.
+// Start with CursorStart and pass the returned cursor to the next call until it returns CursorStart again.
+// Count is a hint of how many keys to examine, fewer keys can be returned if some don't match.
+// The database is only locked for a single page. Keys are walked in order and the cursor is the last examined key,
+// so every key which exists for the whole scan is returned exactly once, regardless of concurrent writes
+func (d *DB) ScanCursor(cursor, match string, count int) ([]string, string, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := validGlob(match); err != nil {
+		return nil, "", err
+	}
+	if count <= 0 {
+		count = DefaultCursorCount
+	}
+
+	// Keys matching the pattern all start with it's literal prefix, so the walk can skip ahead and stop early
+	prefix := globPrefix(match)
+	from := after
+	if prefix > from {
+		from = prefix
+	}
+
+	defer d.rlockAll()()
+
+	keys := []string{}
+	examined := 0
+	last := ""
+	done := true
+	d.ascend(from, func(k string, _ interface{}) bool {
+		if k == after && cursor != CursorStart {
+			return true
+		}
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if examined == count {
+			done = false
+			return false
+		}
+		examined++
+		last = k
+		if (match == "" || matchGlob(match, k)) && !d.expired(k) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+
+	if done {
+		return keys, CursorStart, nil
+	}
+	return keys, encodeCursor(last), nil
+}
+
+func encodeCursor(key string) string {
+	// keys are prefixed so the empty key doesn't encode to an empty cursor
+	return base64.RawURLEncoding.EncodeToString([]byte("k" + key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == CursorStart || cursor == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) == 0 || b[0] != 'k' {
+		return "", errors.New("invalid cursor")
+	}
+	return string(b[1:]), nil
+}
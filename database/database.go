@@ -4,35 +4,111 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/maracko/go-store/database/engine"
 	"github.com/maracko/go-store/database/helpers"
 	"github.com/maracko/go-store/database/write"
 )
 
-// DB represents the database struct
+// ErrClosed is returned by writes to a database after it's disconnected, like one of a dropped namespace
+var ErrClosed = errors.New("database is closed")
+
+// DB represents the database struct. Keys are split into shards, see shard.go for how it's locked
 type DB struct {
-	location       string
-	database       map[string]interface{}
+	// accessed atomically, kept first so they're 64-bit aligned on 32-bit platforms
+	revision uint64
+	used     int64
+	clock    uint64
+	evicted  uint64
+	rejected uint64
+
+	location  string
+	newEngine func() engine.Engine
+	shards    []*shard
+	// index keeps keys sorted unless there's a single shard with an ordered engine. Along with entries of
+	// indexes it's guarded by indexMu, since writes to all shards change them
+	index   *engine.Tree
+	indexes map[string]*secondaryIndex
+	indexMu sync.Mutex
+
+	// watchers is guarded by watchMu, watching is it's length for checking if there are any without locking
+	watchers map[*Watcher]struct{}
+	watching int32
+	watchMu  sync.Mutex
+
+	reaperDone chan struct{}
+	// closed is set by Disconnect and cleared by Connect, it's accessed atomically
+	closed         int32
 	memory         bool
 	continousWrite bool
 	writeInterval  int
 	errChan        chan error
 	jobsChan       chan *write.WriteData
 	writeService   *write.WriteService
-	mu             sync.Mutex
+	appendOnly     bool
+	fsync          write.FsyncPolicy
+
+	// snapshot writes replace only segments holding keys changed since the last write, see segment.go.
+	// Writes are taken and sent one at a time with writeMu held, so they reach the write service in order
+	segments       int
+	fullWrite      bool
+	indexesChanged bool
+	writeMu        sync.Mutex
+
+	// memory limit and eviction policy, see memory.go
+	maxMemory int64
+	policy    EvictionPolicy
+}
+
+// Option configures optional DB behaviour
+type Option func(*DB)
+
+// WithAppendOnly persists every change to an append-only log instead of writing snapshots
+func WithAppendOnly(fsync write.FsyncPolicy) Option {
+	return func(d *DB) {
+		d.appendOnly = true
+		d.fsync = fsync
+	}
+}
+
+// WithEngine stores data in engines created by factory instead of the default HAMT engine, one for each shard
+func WithEngine(factory func() engine.Engine) Option {
+	return func(d *DB) {
+		d.newEngine = factory
+	}
+}
+
+// WithBackups keeps n previous snapshots next to the database file, used if the newest one is corrupt
+func WithBackups(n int) Option {
+	return func(d *DB) {
+		d.writeService.Backups = n
+	}
+}
+
+// WithLogRewrite sets when the append-only log is rewritten automatically: once it's at least minSize bytes
+// and has grown by growth percent since the last rewrite. Growth of 0 disables automatic rewrites
+func WithLogRewrite(minSize int64, growth int) Option {
+	return func(d *DB) {
+		d.writeService.RewriteMinSize = minSize
+		d.writeService.RewriteGrowth = growth
+	}
 }
 
 // New initializes a database to a given location and sets it's internal DB to an empty map or reads from file first
-func New(location string, memory bool, continousWrite bool, ec chan error, wd chan bool, writeInt int) *DB {
+func New(location string, memory bool, continousWrite bool, ec chan error, wd chan bool, writeInt int, opts ...Option) *DB {
 
 	jc := make(chan *write.WriteData, 2)
 	ws := write.NewWriteService(location, jc, ec, wd)
-	return &DB{
+	d := &DB{
 		location:       location,
-		database:       make(map[string]interface{}),
+		newEngine:      func() engine.Engine { return engine.NewHAMT() },
+		shards:         make([]*shard, DefaultShards),
+		segments:       DefaultSegments,
+		indexes:        make(map[string]*secondaryIndex),
+		policy:         NoEviction,
 		errChan:        ec,
 		jobsChan:       jc,
 		memory:         memory,
@@ -40,31 +116,42 @@ func New(location string, memory bool, continousWrite bool, ec chan error, wd ch
 		continousWrite: continousWrite,
 		writeInterval:  writeInt,
 	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	for i := range d.shards {
+		d.shards[i] = newShard(d.newEngine())
+	}
+	if _, ok := d.shards[0].data.(ordered); !ok || len(d.shards) > 1 {
+		d.index = engine.NewTree()
+	}
+	return d
 }
 
 // Connect connects to file and saves it's contents to database field
 func (d *DB) Connect() error {
-	if d.database == nil {
+	if len(d.shards) == 0 || d.shards[0].data == nil {
 		return errors.New("db not initialized")
 	}
+	atomic.StoreInt32(&d.closed, 0)
 
 	if d.location == "" {
+		d.startReaper()
 		return nil
 	}
-	if !helpers.FileExists(d.location) && !d.memory {
-		f, err := os.Create(d.location)
-		if err != nil {
-			return err
-		}
-		if _, err = f.WriteString("{}"); err != nil {
+	if d.appendOnly {
+		if err := d.loadLog(); err != nil {
 			return err
 		}
+		d.startReaper()
+		return nil
 	}
-	db, err := helpers.ReadJsonToMap(d.location)
+	snap, err := d.readSnapshot()
 	if err != nil {
-		return errors.New("cannot read file: " + err.Error())
+		return err
 	}
-	d.database = db
+	d.load(snap)
+	d.startReaper()
 
 	if d.memory {
 		return nil
@@ -78,39 +165,57 @@ func (d *DB) Connect() error {
 	return nil
 }
 
-// NewWrite sends a copy of database to write job queue
+// NewWrite sends segments with keys changed since the last write to the write job queue
 func (d *DB) NewWrite() {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if !d.shouldWrite() {
+	d.flush(false)
+}
+
+// flush sends a write job with changes since the last one, unless force is false and the write interval hasn't
+// passed yet. The state is taken while keys are locked but encoded without holding any locks, so writes aren't
+// blocked while it's encoded
+func (d *DB) flush(force bool) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	unlock := d.rlockAll()
+	if !force && !d.shouldWrite() {
+		unlock()
 		return
 	}
-	sendData := map[string]interface{}{}
-	for k, v := range d.database {
-		sendData[k] = v
+	c, ok := d.takeChanges()
+	if !ok {
+		unlock()
+		return
 	}
-	data := write.NewWriteData(sendData)
-	d.jobsChan <- &data
-}
+	s := d.state()
+	unlock()
 
-func (d *DB) sendData() {
-	sendData := map[string]interface{}{}
-	for k, v := range d.database {
-		sendData[k] = v
-	}
-	data := write.NewWriteData(sendData)
+	data := s.writeData(c)
 	d.jobsChan <- &data
 }
 
-// Disconnect encodes database with json and saves it to location if provided
+// Disconnect writes remaining changes to location if provided. Later writes fail with ErrClosed
 func (d *DB) Disconnect() error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if len(d.database) == 0 || d.location == "" || d.memory {
+	unlock := d.lockAll()
+	atomic.StoreInt32(&d.closed, 1)
+	// blocked pops wake up and fail with ErrClosed
+	for _, s := range d.shards {
+		for k, ch := range s.pushed {
+			close(ch)
+			delete(s.pushed, k)
+		}
+	}
+	d.stopReaper()
+	d.CloseWatchers()
+	if d.appendOnly {
+		defer unlock()
+		return d.writeService.CloseLog()
+	}
+	unlock()
+	if d.location == "" || d.memory {
 		return nil
 	}
 
-	go d.sendData()
+	d.flush(true)
 	//Send shutdown signal to write service
 	d.writeService.WritesDone <- true
 	//Wait until write service has finished
@@ -121,35 +226,43 @@ func (d *DB) Disconnect() error {
 
 // Create creates a new record
 func (d *DB) Create(key string, value interface{}) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if _, ok := d.database[key]; ok {
-		return fmt.Errorf("%s already exists", key)
+	return d.CreateWithTTL(key, value, 0)
+}
+
+// CreateWithTTL creates a new record which expires after ttl. If ttl is 0 the record never expires
+func (d *DB) CreateWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ttl %v", ttl)
 	}
-	d.database[key] = value
-	if d.continousWrite && !d.memory {
-		go d.NewWrite()
+	if err := d.makeRoom(); err != nil {
+		return err
+	}
+	defer d.lock(key).mu.Unlock()
+	if _, ok := d.lookup(key); ok {
+		return fmt.Errorf("%s already exists", key)
 	}
+	d.put(key, value)
+	d.setExpiry(key, ttl)
+	d.changed(key)
 	return nil
 }
 
 // Read reads from a single key
 func (d *DB) Read(key string) (interface{}, error) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if _, ok := d.database[key]; !ok {
+	defer d.rlock(key).mu.RUnlock()
+	v, ok := d.lookup(key)
+	if !ok {
 		return nil, fmt.Errorf("%s doesn't exist", key)
 	}
-	return d.database[key], nil
+	return v, nil
 }
 
 // ReadMany returns multiple keys
 func (d *DB) ReadMany(keys ...string) map[string]interface{} {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	defer d.rlockKeys(keys...)()
 	results := make(map[string]interface{})
 	for _, k := range keys {
-		if v, ok := d.database[k]; !ok {
+		if v, ok := d.lookup(k); !ok {
 			results[k] = nil
 		} else {
 			results[k] = v
@@ -160,48 +273,62 @@ func (d *DB) ReadMany(keys ...string) map[string]interface{} {
 
 // ReadAll returns all entries from DB
 func (d *DB) ReadAll() string {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	defer d.rlockAll()()
 	str := ""
-	for k, v := range d.database {
-		str += fmt.Sprintf("%v => %v\n", k, v)
+	for _, s := range d.shards {
+		s.data.Iterate(func(k string, v interface{}) bool {
+			if !d.expired(k) {
+				str += fmt.Sprintf("%v => %v\n", k, v)
+			}
+			return true
+		})
 	}
 	return str
 }
 
 // Update updates a single entry
 func (d *DB) Update(key string, value interface{}) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if _, ok := d.database[key]; !ok {
+	return d.UpdateWithTTL(key, value, 0)
+}
+
+// UpdateWithTTL updates a single entry and sets it to expire after ttl. If ttl is 0 the current expiry is kept
+func (d *DB) UpdateWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("invalid ttl %v", ttl)
+	}
+	if err := d.makeRoom(); err != nil {
+		return err
+	}
+	defer d.lock(key).mu.Unlock()
+	if _, ok := d.lookup(key); !ok {
 		return fmt.Errorf("%s doesn't exist", key)
 	}
 
-	d.database[key] = value
-	if d.continousWrite && !d.memory {
-		go d.NewWrite()
+	d.put(key, value)
+	if ttl > 0 {
+		d.setExpiry(key, ttl)
 	}
+	d.changed(key)
 	return nil
 }
 
 // Delete deletes a single entry
 func (d *DB) Delete(key string) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if _, ok := d.database[key]; !ok {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	defer d.lock(key).mu.Unlock()
+	if _, ok := d.lookup(key); !ok {
 		return fmt.Errorf("%s doesn't exist", key)
 	}
 
-	delete(d.database, key)
-	if d.continousWrite && !d.memory {
-		go d.NewWrite()
-	}
+	d.remove(key)
+	d.changed(key)
 	return nil
 }
 
 func (d *DB) DeleteMany(keys ...string) map[string]interface{} {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	defer d.lockKeys(keys...)()
 
 	res := make(map[string]interface{})
 
@@ -210,22 +337,179 @@ func (d *DB) DeleteMany(keys ...string) map[string]interface{} {
 
 	err := make(map[string]string, 1)
 	err["error"] = "key doesn't exist"
+	if cerr := d.checkOpen(); cerr != nil {
+		err["error"] = cerr.Error()
+		for _, key := range keys {
+			res[key] = err
+		}
+		return res
+	}
 
+	deleted := make([]string, 0, len(keys))
 	for _, key := range keys {
-		if _, ok := d.database[key]; !ok {
+		if _, ok := d.lookup(key); !ok {
 			res[key] = err
 		} else {
-			delete(d.database, key)
+			d.remove(key)
 			res[key] = del
+			deleted = append(deleted, key)
 		}
 
 	}
-	if d.continousWrite && !d.memory {
-		go d.NewWrite()
+	if len(deleted) > 0 {
+		d.changed(deleted...)
 	}
 	return res
 }
 
+// lookup returns the value of key, hiding it if it has expired. Caller must lock key
+func (d *DB) lookup(key string) (interface{}, bool) {
+	if d.expired(key) {
+		return nil, false
+	}
+	v, ok := d.shardOf(key).data.Get(key)
+	if ok {
+		d.touch(key)
+	}
+	return v, ok
+}
+
+// put stores value under key and bumps it's version. Caller must lock key
+func (d *DB) put(key string, value interface{}) {
+	s := d.shardOf(key)
+	watched := d.watched()
+	var ev Event
+	if watched {
+		ev = Event{Type: EventCreate, Key: key, New: value}
+		if old, ok := d.lookup(key); ok {
+			ev.Type, ev.Old = EventUpdate, old
+		}
+	}
+
+	old, existed := s.data.Get(key)
+	if len(d.indexes) > 0 || (d.index != nil && !existed) {
+		d.indexMu.Lock()
+		d.reindex(key, old, value)
+		if d.index != nil && !existed {
+			d.index.Put(key, nil)
+		}
+		d.indexMu.Unlock()
+	}
+	s.data.Put(key, value)
+	revision := atomic.AddUint64(&d.revision, 1)
+	s.versions.Put(key, revision)
+	d.account(key, value, false)
+	d.touch(key)
+
+	if watched {
+		ev.Version = revision
+		d.notify(ev)
+	}
+}
+
+// remove deletes key along with it's expiry. Caller must lock key
+func (d *DB) remove(key string) {
+	s := d.shardOf(key)
+	old, existed := s.data.Get(key)
+	if existed && d.watched() {
+		d.notify(Event{Type: EventDelete, Key: key, Old: old})
+	}
+	if existed && (len(d.indexes) > 0 || d.index != nil) {
+		d.indexMu.Lock()
+		d.reindex(key, old, nil)
+		if d.index != nil {
+			d.index.Delete(key)
+		}
+		d.indexMu.Unlock()
+	}
+	s.data.Delete(key)
+	s.expires.Delete(key)
+	s.versions.Delete(key)
+	d.account(key, nil, true)
+}
+
+// load adds the contents of snap to the database
+func (d *DB) load(snap *helpers.Snapshot) {
+	for name, def := range snap.Indexes {
+		if err := d.createIndex(name, def); err != nil {
+			log.Printf("Skipping index %s: %v", name, err)
+		}
+	}
+	for k, v := range snap.Data {
+		d.put(k, restoreType(k, snap.Types[k], v))
+		d.restoreVersion(k, snap.Versions[k])
+	}
+	for k, exp := range snap.Expires {
+		d.shardOf(k).expires.Put(k, exp)
+	}
+}
+
+// readSnapshot reads the snapshot at d.location merged with it's segments, falling back to the newest intact
+// backup of any corrupt file. Databases written before keys were split into segments are split by the next write
+func (d *DB) readSnapshot() (*helpers.Snapshot, error) {
+	snap := helpers.NewSnapshot(make(map[string]interface{}), nil, nil, nil)
+	if helpers.FileExists(d.location) || helpers.FileExists(helpers.BackupPath(d.location, 1)) {
+		s, from, err := helpers.ReadLatestSnapshot(d.location)
+		if err != nil {
+			return nil, errors.New("cannot read file: " + err.Error())
+		}
+		if from != d.location {
+			log.Printf("Could not read %s, restored from backup %s", d.location, from)
+		}
+		snap = s
+	}
+
+	dir := helpers.SegmentDir(d.location)
+	d.fullWrite = false
+	if !helpers.FileExists(dir) {
+		old := helpers.OldSegmentDir(dir)
+		if !helpers.FileExists(old) {
+			d.fullWrite = true
+			return snap, nil
+		}
+		// replacing segments was interrupted before the new ones were in place, the previous ones are complete
+		// and the next write replaces them again
+		log.Printf("Segments in %s were being replaced, reading previous ones from %s", dir, old)
+		dir, d.fullWrite = old, true
+	}
+	// once split, keys in the database file are ignored. They can only be left from before it was split
+	// and are in the segments already, or come from an outdated backup of it
+	merged := helpers.NewSnapshot(make(map[string]interface{}), make(map[string]time.Time), make(map[string]uint64), make(map[string]string))
+	merged.Indexes = snap.Indexes
+	n, err := readSegments(dir, merged)
+	if err != nil {
+		return nil, err
+	}
+	d.segments = n
+	return merged, nil
+}
+
+// changed persists keys after they were modified, either by logging them or scheduling a snapshot write.
+// Caller must lock keys
+func (d *DB) changed(keys ...string) {
+	// a write which checked the database was open before it was disconnected isn't persisted,
+	// so files of a dropped namespace aren't recreated
+	if d.memory || d.location == "" || atomic.LoadInt32(&d.closed) == 1 {
+		return
+	}
+	if d.appendOnly {
+		d.logKeys(keys...)
+		return
+	}
+	d.markDirty(keys...)
+	if d.continousWrite {
+		go d.NewWrite()
+	}
+}
+
+// checkOpen returns ErrClosed once the database is disconnected
+func (d *DB) checkOpen() error {
+	if atomic.LoadInt32(&d.closed) == 1 {
+		return ErrClosed
+	}
+	return nil
+}
+
 func (d *DB) shouldWrite() bool {
 	if d.writeInterval == 0 {
 		return true
@@ -0,0 +1,1466 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maracko/go-store/database/document"
+	"github.com/maracko/go-store/database/engine"
+	"github.com/maracko/go-store/database/helpers"
+	"github.com/maracko/go-store/database/query"
+	"github.com/maracko/go-store/database/write"
+)
+
+func newMemoryDB(t *testing.T) *DB {
+	t.Helper()
+	d := New("", true, false, make(chan error, 10), make(chan bool), 0)
+	if err := d.Connect(); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	t.Cleanup(func() { _ = d.Disconnect() })
+	return d
+}
+
+func TestExpiredKeysAreHidden(t *testing.T) {
+	d := newMemoryDB(t)
+
+	if err := d.CreateWithTTL("foo", "bar", time.Millisecond); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := d.Read("foo"); err == nil {
+		t.Error("expired key was returned")
+	}
+	if err := d.Create("foo", "baz"); err != nil {
+		t.Errorf("create over expired key failed: %s", err)
+	}
+	if ttl, _ := d.TTL("foo"); ttl != NoExpiry {
+		t.Errorf("expected no expiry, got %v", ttl)
+	}
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	d := newMemoryDB(t)
+	_ = d.Create("foo", "bar")
+
+	if err := d.Expire("foo", time.Hour); err != nil {
+		t.Fatalf("expire failed: %s", err)
+	}
+	if ttl, _ := d.TTL("foo"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("unexpected ttl %v", ttl)
+	}
+	if err := d.Persist("foo"); err != nil {
+		t.Fatalf("persist failed: %s", err)
+	}
+	if ttl, _ := d.TTL("foo"); ttl != NoExpiry {
+		t.Errorf("expected no expiry, got %v", ttl)
+	}
+	if err := d.Expire("missing", time.Hour); err == nil {
+		t.Error("expected error for missing key")
+	}
+}
+
+func TestReaperRemovesExpiredKeys(t *testing.T) {
+	d := newMemoryDB(t)
+	_ = d.CreateWithTTL("foo", "bar", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	d.reap()
+
+	defer d.rlock("foo").mu.RUnlock()
+	if _, ok := d.shardOf("foo").data.Get("foo"); ok {
+		t.Error("reaper didn't remove expired key")
+	}
+}
+
+func TestAppendOnlyReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	open := func() *DB {
+		d := New(path, false, false, make(chan error, 10), make(chan bool), 0, WithAppendOnly(write.FsyncAlways))
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return d
+	}
+
+	d := open()
+	_ = d.Create("foo", "bar")
+	_ = d.CreateWithTTL("tmp", "x", time.Hour)
+	_ = d.Update("foo", "baz")
+	_ = d.Create("gone", 1.0)
+	d.DeleteMany("gone", "missing")
+	_, version, _ := d.ReadWithVersion("foo")
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+
+	// simulate a crash in the middle of a write
+	f, err := os.OpenFile(path+".aof", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"set","key":"half`)
+	f.Close()
+
+	d = open()
+	defer d.Disconnect()
+	if v, replayed, err := d.ReadWithVersion("foo"); err != nil || v != "baz" || replayed != version {
+		t.Errorf("expected baz at version %d, got %v at %d (%v)", version, v, replayed, err)
+	}
+	if _, err := d.Read("gone"); err == nil {
+		t.Error("deleted key was replayed")
+	}
+	if ttl, _ := d.TTL("tmp"); ttl <= 0 {
+		t.Errorf("expiry was not replayed, got %v", ttl)
+	}
+}
+
+func TestRewriteLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	d := New(path, false, false, make(chan error, 10), make(chan bool), 0, WithAppendOnly(write.FsyncNo))
+	if err := d.Connect(); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		_ = d.Create("foo", i)
+		_ = d.Delete("foo")
+	}
+	_ = d.Create("bar", "baz")
+
+	// a write made between capturing state and replacing the log must survive
+	unlock := d.rlockAll()
+	s, err := d.beginRewrite()
+	if err != nil {
+		t.Fatalf("begin rewrite failed: %s", err)
+	}
+	unlock()
+	_ = d.Create("during", true)
+	if err := d.RewriteLog(); err != write.ErrRewriteInProgress {
+		t.Errorf("expected ErrRewriteInProgress, got %v", err)
+	}
+	if err := d.writeService.Rewrite(s.records()); err != nil {
+		t.Fatalf("rewrite failed: %s", err)
+	}
+	_ = d.Create("after", true)
+	_ = d.Disconnect()
+
+	n, err := d.writeService.ReplayLog(func(*write.Record) {})
+	if err != nil || n != 3 {
+		t.Errorf("expected 3 records after rewrite, got %d (%v)", n, err)
+	}
+
+	d = New(path, true, false, make(chan error, 10), make(chan bool), 0, WithAppendOnly(write.FsyncNo))
+	if err := d.Connect(); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	for _, k := range []string{"bar", "during", "after"} {
+		if _, err := d.Read(k); err != nil {
+			t.Errorf("%s missing after rewrite", k)
+		}
+	}
+}
+
+func TestCorruptSnapshotFallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	save := func(key string) {
+		ec := make(chan error, 10)
+		d := New(path, false, false, ec, make(chan bool), 0, WithBackups(2))
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		_ = d.Create(key, true)
+		if err := d.Disconnect(); err != nil {
+			t.Fatalf("disconnect failed: %s", err)
+		}
+	}
+	save("first")
+	save("second")
+
+	seg := helpers.SegmentPath(helpers.SegmentDir(path), segmentOf("second", DefaultSegments))
+	b, err := os.ReadFile(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(seg, b[:len(b)-5], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(path, true, false, make(chan error, 10), make(chan bool), 0)
+	if err := d.Connect(); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	if _, err := d.Read("first"); err != nil {
+		t.Error("backup was not restored")
+	}
+	if _, err := d.Read("second"); err == nil {
+		t.Error("corrupt snapshot was read")
+	}
+}
+
+func TestSegmentedWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	legacy := map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		legacy[fmt.Sprintf("k%d", i)] = fmt.Sprint(i)
+	}
+	b, _ := json.Marshal(legacy)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	open := func(opts ...Option) *DB {
+		d := New(path, false, false, make(chan error, 10), make(chan bool), 0, opts...)
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return d
+	}
+	stat := func(f string) os.FileInfo {
+		info, err := os.Stat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	// the first write splits the database into segments
+	d := open(WithSegments(8))
+	_ = d.Update("k0", "changed")
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+	dir := helpers.SegmentDir(path)
+	before := make([]os.FileInfo, 8)
+	for i := range before {
+		before[i] = stat(helpers.SegmentPath(dir, i))
+	}
+	manifest := stat(path)
+
+	// a single key change replaces only it's segment
+	d = open(WithSegments(4))
+	if d.segments != 8 {
+		t.Errorf("expected existing database to keep 8 segments, got %d", d.segments)
+	}
+	_ = d.Update("k1", "changed")
+	_ = d.Delete("k1")
+	_ = d.Create("k1", "again")
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+	for i := range before {
+		if rewritten := !os.SameFile(before[i], stat(helpers.SegmentPath(dir, i))); rewritten != (i == segmentOf("k1", 8)) {
+			t.Errorf("segment %d rewritten: %v", i, rewritten)
+		}
+	}
+	if !os.SameFile(manifest, stat(path)) {
+		t.Error("database file was rewritten without index changes")
+	}
+
+	d = open()
+	defer d.Disconnect()
+	for k, want := range legacy {
+		switch k {
+		case "k0":
+			want = "changed"
+		case "k1":
+			want = "again"
+		}
+		if v, err := d.Read(k); err != nil || v != want {
+			t.Errorf("expected %s to be %v, got %v (%v)", k, want, v, err)
+		}
+	}
+}
+
+func TestInterruptedSegmentReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	open := func() *DB {
+		d := New(path, false, false, make(chan error, 10), make(chan bool), 0)
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return d
+	}
+	check := func(d *DB, changed string) {
+		t.Helper()
+		for i := 0; i < 20; i++ {
+			k, want := fmt.Sprintf("k%d", i), "v"
+			if k == changed {
+				want = "changed"
+			}
+			if v, err := d.Read(k); err != nil || v != want {
+				t.Errorf("expected %s to be %s, got %v (%v)", k, want, v, err)
+			}
+		}
+	}
+
+	d := open()
+	for i := 0; i < 20; i++ {
+		_ = d.Create(fmt.Sprintf("k%d", i), "v")
+	}
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+	dir := helpers.SegmentDir(path)
+	old := helpers.OldSegmentDir(dir)
+
+	// interrupted after existing segments were moved aside, before new ones were moved in place
+	if err := os.Rename(dir, old); err != nil {
+		t.Fatal(err)
+	}
+	d = open()
+	check(d, "")
+	_ = d.Update("k0", "changed")
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+	if helpers.FileExists(old) || !helpers.FileExists(dir) {
+		t.Fatal("expected segments to be replaced")
+	}
+
+	// interrupted after new segments were moved in place, before old ones were removed
+	stale := helpers.NewSnapshot(map[string]interface{}{"stale": "v"}, nil, nil, nil)
+	stale.Segments = 1
+	b, _ := helpers.EncodeSnapshot(stale)
+	if err := os.Mkdir(old, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(helpers.SegmentPath(old, 0), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	d = open()
+	defer d.Disconnect()
+	check(d, "k0")
+	if _, err := d.Read("stale"); err == nil {
+		t.Error("outdated segments were read")
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, name := range engine.Names() {
+		t.Run(name, func(t *testing.T) {
+			factory, _ := engine.Factory(name)
+			d := New("", true, false, make(chan error, 10), make(chan bool), 0, WithEngine(factory))
+			for _, k := range []string{"user:2:profile", "user:1:profile", "order:1", "user:10:profile", "users"} {
+				_ = d.Create(k, k)
+			}
+			_ = d.CreateWithTTL("user:0:expired", true, time.Millisecond)
+			_ = d.Delete("order:1")
+			time.Sleep(5 * time.Millisecond)
+
+			keys := func(entries []Entry) string {
+				res := []string{}
+				for _, e := range entries {
+					res = append(res, e.Key)
+				}
+				return strings.Join(res, ",")
+			}
+
+			if got := keys(d.Scan("user:", "", "", 0)); got != "user:10:profile,user:1:profile,user:2:profile" {
+				t.Errorf("prefix scan returned %s", got)
+			}
+			if got := keys(d.Scan("user:", "", "", 2)); got != "user:10:profile,user:1:profile" {
+				t.Errorf("limited scan returned %s", got)
+			}
+			if got := keys(d.Scan("", "user:1:", "users", 0)); got != "user:1:profile,user:2:profile" {
+				t.Errorf("range scan returned %s", got)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"user:*", "user:1:profile", true},
+		{"user:*:profile", "user:1/2:profile", true},
+		{"user:?", "user:12", false},
+		{"user:[0-4]", "user:3", true},
+		{"user:[^0-4]", "user:3", false},
+		{"user:[!a]", "user:b", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		if err := validGlob(c.pattern); err != nil {
+			t.Fatalf("%s: %s", c.pattern, err)
+		}
+		if got := matchGlob(c.pattern, c.s); got != c.match {
+			t.Errorf("match(%q, %q) = %v", c.pattern, c.s, got)
+		}
+	}
+	if validGlob("user:[a") == nil {
+		t.Error("unclosed class was accepted")
+	}
+}
+
+func TestScanCursorUnderWrites(t *testing.T) {
+	d := New("", true, false, make(chan error, 10), make(chan bool), 0)
+	for i := 0; i < 1000; i++ {
+		_ = d.Create(fmt.Sprintf("stable:%04d", i), i)
+	}
+
+	stop := make(chan struct{})
+	churned := make(chan struct{})
+	go func() {
+		defer close(churned)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			k := fmt.Sprintf("stable:%04d:churn", i%1000)
+			if d.Create(k, i) != nil {
+				_ = d.Delete(k)
+			}
+		}
+	}()
+
+	seen := map[string]int{}
+	cursor := CursorStart
+	for {
+		keys, next, err := d.ScanCursor(cursor, "stable:[0-9][0-9][0-9][0-9]", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			seen[k]++
+		}
+		if cursor = next; cursor == CursorStart {
+			break
+		}
+	}
+	close(stop)
+	<-churned
+
+	if len(seen) != 1000 {
+		t.Errorf("expected 1000 keys, got %d", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("%s returned %d times", k, n)
+		}
+	}
+	if _, _, err := d.ScanCursor("not a cursor", "", 0); err == nil {
+		t.Error("invalid cursor was accepted")
+	}
+}
+
+func TestTxnRollsBackOnError(t *testing.T) {
+	d := newMemoryDB(t)
+	_ = d.Create("a", 1.0)
+	_ = d.Create("b", 2.0)
+
+	err := d.Txn(func(tx *Tx) error {
+		if err := tx.Update("a", 10.0); err != nil {
+			return err
+		}
+		if err := tx.Delete("b"); err != nil {
+			return err
+		}
+		if v, _ := tx.Read("a"); v != 10.0 {
+			t.Errorf("transaction didn't see it's own write, got %v", v)
+		}
+		return tx.Update("missing", 0.0)
+	})
+	if err == nil {
+		t.Fatal("expected transaction to fail")
+	}
+	if v, _ := d.Read("a"); v != 1.0 {
+		t.Errorf("update was not rolled back, got %v", v)
+	}
+	if _, err := d.Read("b"); err != nil {
+		t.Error("delete was not rolled back")
+	}
+
+	err = d.Txn(func(tx *Tx) error {
+		if err := tx.Delete("a"); err != nil {
+			return err
+		}
+		return tx.Create("c", 3.0)
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %s", err)
+	}
+	if _, err := d.Read("a"); err == nil {
+		t.Error("delete was not committed")
+	}
+	if v, _ := d.Read("c"); v != 3.0 {
+		t.Errorf("create was not committed, got %v", v)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	d := newMemoryDB(t)
+
+	v1, err := d.CompareAndSwap("foo", 0, "a")
+	if err != nil {
+		t.Fatalf("cas create failed: %s", err)
+	}
+	if _, err := d.CompareAndSwap("foo", 0, "b"); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("expected version mismatch creating existing key, got %v", err)
+	}
+
+	v2, err := d.CompareAndSwap("foo", v1, "b")
+	if err != nil || v2 <= v1 {
+		t.Fatalf("cas failed: version %d, %v", v2, err)
+	}
+	if _, err := d.CompareAndSwap("foo", v1, "c"); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("expected version mismatch for stale version, got %v", err)
+	}
+
+	_ = d.Update("foo", "d")
+	if val, v3, _ := d.ReadWithVersion("foo"); v3 <= v2 || val != "d" {
+		t.Errorf("update didn't bump version: %d <= %d", v3, v2)
+	}
+	if _, err := d.CompareAndSwap("bar", v1, "a"); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("expected missing key, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	d := newMemoryDB(t)
+	w := d.Watch("user:")
+	defer w.Close()
+
+	_ = d.Create("user:1", "a")
+	_ = d.Create("order:1", "ignored")
+	_ = d.Update("user:1", "b")
+	_ = d.Delete("user:1")
+
+	expected := []Event{
+		{Type: EventCreate, Key: "user:1", New: "a"},
+		{Type: EventUpdate, Key: "user:1", Old: "a", New: "b"},
+		{Type: EventDelete, Key: "user:1", Old: "b"},
+	}
+	for _, exp := range expected {
+		ev := <-w.Events
+		if ev.Type != exp.Type || ev.Key != exp.Key || ev.Old != exp.Old || ev.New != exp.New {
+			t.Errorf("expected %+v, got %+v", exp, ev)
+		}
+	}
+
+	slow := d.Watch("")
+	for i := 0; i <= WatchBuffer; i++ {
+		_ = d.Update("order:1", i)
+	}
+	n := 0
+	for range slow.Events {
+		n++
+	}
+	if n != WatchBuffer || slow.Err() != ErrWatchOverflow {
+		t.Errorf("expected overflow after %d events, got %d events and %v", WatchBuffer, n, slow.Err())
+	}
+}
+
+func TestRegistryNamespaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	open := func() *Registry {
+		r := NewRegistry(path, func(l string) *DB {
+			return New(l, false, false, make(chan error, 10), make(chan bool), 0, WithAppendOnly(write.FsyncNo))
+		})
+		if err := r.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return r
+	}
+
+	r := open()
+	users, err := r.Create("users")
+	if err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	if _, err := r.Create("users"); err == nil {
+		t.Error("namespace was created twice")
+	}
+	if _, err := r.Create("../etc"); err == nil {
+		t.Error("invalid namespace name was accepted")
+	}
+	_ = r.Default().Create("foo", "default")
+	_ = users.Create("foo", "users")
+	_, _ = r.Create("tmp")
+	if err := r.Drop("tmp"); err != nil {
+		t.Errorf("drop failed: %s", err)
+	}
+	if err := r.Drop(DefaultNamespace); err == nil {
+		t.Error("default namespace was dropped")
+	}
+	if err := r.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+
+	r = open()
+	defer r.Disconnect()
+	if names := fmt.Sprint(r.Names()); names != "[default users]" {
+		t.Errorf("expected [default users], got %s", names)
+	}
+	users, err = r.Get("users")
+	if err != nil {
+		t.Fatalf("namespace was not reloaded: %s", err)
+	}
+	if v, _ := r.Default().Read("foo"); v != "default" {
+		t.Errorf("expected default, got %v", v)
+	}
+	if v, _ := users.Read("foo"); v != "users" {
+		t.Errorf("expected users, got %v", v)
+	}
+}
+
+func TestDropClosesNamespace(t *testing.T) {
+	for _, appendOnly := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "db.json")
+		r := NewRegistry(path, func(l string) *DB {
+			if appendOnly {
+				return New(l, false, false, make(chan error, 10), make(chan bool), 0, WithAppendOnly(write.FsyncNo))
+			}
+			return New(l, false, true, make(chan error, 10), make(chan bool), 0)
+		})
+		if err := r.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		tmp, _ := r.Create("tmp")
+		_ = tmp.Create("a", 1)
+
+		popped := make(chan error)
+		go func() {
+			_, err := tmp.BLPop(context.Background(), "q", time.Minute)
+			popped <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		if err := r.Drop("tmp"); err != nil {
+			t.Fatalf("drop failed: %s", err)
+		}
+		select {
+		case err := <-popped:
+			if err != ErrClosed {
+				t.Errorf("expected blocked pop to fail with ErrClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("blocked pop still waits after drop")
+		}
+
+		// a handle taken before the drop can't write, nor recreate files of the namespace
+		if err := tmp.Create("b", 1); err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+		if _, err := tmp.RPush("q", 1); err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+		if err := tmp.Delete("a"); err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+		tmp.NewWrite()
+		time.Sleep(20 * time.Millisecond)
+		if files, _ := filepath.Glob(filepath.Join(path+".ns", "tmp*")); len(files) > 0 {
+			t.Errorf("files of dropped namespace were recreated: %v", files)
+		}
+		_ = r.Disconnect()
+	}
+}
+
+func TestList(t *testing.T) {
+	d := newMemoryDB(t)
+
+	if n, err := d.RPush("q", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("expected length 2, got %d (%v)", n, err)
+	}
+	if n, _ := d.LPush("q", "a", "z"); n != 4 {
+		t.Errorf("expected length 4, got %d", n)
+	}
+	before, _ := d.LRange("q", 0, -1)
+	if v, _ := d.RPop("q"); v != "c" {
+		t.Errorf("expected c, got %v", v)
+	}
+	_, _ = d.RPush("q", "d")
+	if fmt.Sprint(before) != "[z a b c]" {
+		t.Errorf("push changed a range read before, got %v", before)
+	}
+	if items, _ := d.LRange("q", 1, -2); fmt.Sprint(items) != "[a b]" {
+		t.Errorf("expected [a b], got %v", items)
+	}
+	if n, _ := d.LTrim("q", -2, 10); n != 2 {
+		t.Errorf("expected length 2 after trim, got %d", n)
+	}
+	if v, _ := d.LPop("q"); v != "b" {
+		t.Errorf("expected b, got %v", v)
+	}
+	_, _ = d.LPop("q")
+	if _, err := d.Read("q"); err == nil {
+		t.Error("empty list was kept")
+	}
+
+	_ = d.Create("plain", "x")
+	if _, err := d.RPush("plain", "y"); err != ErrWrongType {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+
+	// lists stored from the same read share a backing array with spare capacity
+	for _, v := range []string{"1", "2", "3"} {
+		_, _ = d.RPush("shared", v)
+	}
+	l, _ := d.Read("shared")
+	_ = d.Create("copy", l)
+	_, _ = d.RPush("shared", "a")
+	_, _ = d.RPush("copy", "b")
+	if items, _ := d.LRange("shared", 0, -1); fmt.Sprint(items) != "[1 2 3 a]" {
+		t.Errorf("push to a list sharing it's backing array changed it, got %v", items)
+	}
+	if fmt.Sprint(l) != "[1 2 3]" {
+		t.Errorf("push changed a value read before, got %v", l)
+	}
+}
+
+func TestBlockingPop(t *testing.T) {
+	d := newMemoryDB(t)
+
+	if _, err := d.BLPop(context.Background(), "jobs", 10*time.Millisecond); err != ErrPopTimeout {
+		t.Errorf("expected ErrPopTimeout, got %v", err)
+	}
+
+	got := make(chan interface{})
+	go func() {
+		v, _ := d.BRPop(context.Background(), "jobs", time.Second)
+		got <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, _ = d.LPush("jobs", "job1")
+	select {
+	case v := <-got:
+		if v != "job1" {
+			t.Errorf("expected job1, got %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked pop was not woken up")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.BLPop(ctx, "jobs", 0); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestListIsPersistedAsList(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithAppendOnly(write.FsyncNo)}} {
+		path := filepath.Join(t.TempDir(), "db.json")
+		open := func() *DB {
+			d := New(path, false, false, make(chan error, 10), make(chan bool), 0, opts...)
+			if err := d.Connect(); err != nil {
+				t.Fatalf("connect failed: %s", err)
+			}
+			return d
+		}
+
+		d := open()
+		_, _ = d.RPush("q", "a", 1.0)
+		_ = d.Create("array", []interface{}{"plain"})
+		if err := d.Disconnect(); err != nil {
+			t.Fatalf("disconnect failed: %s", err)
+		}
+
+		d = open()
+		if n, err := d.RPush("q", "b"); err != nil || n != 3 {
+			t.Errorf("expected list of 3, got %d (%v)", n, err)
+		}
+		if _, err := d.RPush("array", "b"); err != ErrWrongType {
+			t.Errorf("plain array was restored as a list")
+		}
+		_ = d.Disconnect()
+	}
+}
+
+func TestHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	open := func() *DB {
+		d := New(path, false, false, make(chan error, 10), make(chan bool), 0)
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return d
+	}
+
+	d := open()
+	if created, err := d.HSet("user:1", "name", "ana"); err != nil || !created {
+		t.Fatalf("expected new field, got %v (%v)", created, err)
+	}
+	if created, _ := d.HSet("user:1", "name", "ana"); created {
+		t.Error("existing field was reported as new")
+	}
+	before, _ := d.HGetAll("user:1")
+	if n, err := d.HIncrBy("user:1", "visits", 2); err != nil || n != 2 {
+		t.Errorf("expected 2, got %d (%v)", n, err)
+	}
+	if len(before) != 1 {
+		t.Errorf("incr changed fields read before, got %v", before)
+	}
+	if _, err := d.HIncrBy("user:1", "name", 1); err == nil {
+		t.Error("non integer field was incremented")
+	}
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+
+	d = open()
+	defer d.Disconnect()
+	if n, err := d.HIncrBy("user:1", "visits", 1); err != nil || n != 3 {
+		t.Errorf("expected 3 after restart, got %d (%v)", n, err)
+	}
+	if ok, _ := d.HExists("user:1", "name"); !ok {
+		t.Error("field was not restored")
+	}
+	if n, _ := d.HDel("user:1", "name", "visits", "missing"); n != 2 {
+		t.Errorf("expected 2 deleted fields, got %d", n)
+	}
+	if _, err := d.Read("user:1"); err == nil {
+		t.Error("empty hash was kept")
+	}
+}
+
+func TestSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	open := func() *DB {
+		d := New(path, false, false, make(chan error, 10), make(chan bool), 0, WithAppendOnly(write.FsyncNo))
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return d
+	}
+
+	d := open()
+	if n, _ := d.SAdd("a", "x", "y", "z", "x"); n != 3 {
+		t.Errorf("expected 3 added, got %d", n)
+	}
+	_, _ = d.SAdd("b", "y", "z", "w")
+	if n, _ := d.SRem("b", "w", "missing"); n != 1 {
+		t.Errorf("expected 1 removed, got %d", n)
+	}
+	if n, _ := d.SInterStore("both", "a", "b"); n != 2 {
+		t.Errorf("expected intersection of 2, got %d", n)
+	}
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+
+	d = open()
+	defer d.Disconnect()
+	for _, c := range []struct {
+		name     string
+		res      func(keys ...string) ([]string, error)
+		keys     []string
+		expected string
+	}{
+		{"inter", d.SInter, []string{"a", "b"}, "[y z]"},
+		{"union", d.SUnion, []string{"a", "b", "missing"}, "[x y z]"},
+		{"diff", d.SDiff, []string{"a", "b"}, "[x]"},
+		{"stored", d.SUnion, []string{"both"}, "[y z]"},
+	} {
+		if m, err := c.res(c.keys...); err != nil || fmt.Sprint(m) != c.expected {
+			t.Errorf("%s: expected %s, got %v (%v)", c.name, c.expected, m, err)
+		}
+	}
+	if n, _ := d.SDiffStore("both", "b", "a"); n != 0 {
+		t.Errorf("expected empty difference, got %d", n)
+	}
+	if _, err := d.Read("both"); err == nil {
+		t.Error("storing an empty set kept the key")
+	}
+	_ = d.Create("plain", "x")
+	if _, err := d.SInter("a", "plain"); err != ErrWrongType {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestZSet(t *testing.T) {
+	d := newMemoryDB(t)
+
+	// compare against a sorted slice after random changes
+	scores := map[string]float64{}
+	for i := 0; i < 500; i++ {
+		m := fmt.Sprintf("m%d", (i*7919)%97)
+		if i%5 == 0 {
+			_, _ = d.ZRem("board", m)
+			delete(scores, m)
+			continue
+		}
+		s := float64((i * 31) % 13)
+		if _, err := d.ZAdd("board", map[string]float64{m: s}); err != nil {
+			t.Fatalf("add failed: %s", err)
+		}
+		scores[m] = s
+	}
+	expected := make([]ZMember, 0, len(scores))
+	for m, s := range scores {
+		expected = append(expected, ZMember{m, s})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Score != expected[j].Score {
+			return expected[i].Score < expected[j].Score
+		}
+		return expected[i].Member < expected[j].Member
+	})
+
+	all, _ := d.ZRange("board", 0, -1)
+	if fmt.Sprint(all) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, all)
+	}
+	if n, _ := d.ZCard("board"); n != len(expected) {
+		t.Errorf("expected %d members, got %d", len(expected), n)
+	}
+	for i, m := range expected {
+		if r, s, _ := d.ZRank("board", m.Member); r != i || s != m.Score {
+			t.Fatalf("expected rank %d and score %v for %s, got %d and %v", i, m.Score, m.Member, r, s)
+		}
+	}
+	if top, _ := d.ZRange("board", -3, -1); fmt.Sprint(top) != fmt.Sprint(expected[len(expected)-3:]) {
+		t.Errorf("expected top 3 %v, got %v", expected[len(expected)-3:], top)
+	}
+	byScore, _ := d.ZRangeByScore("board", 4, 6, 0)
+	for _, m := range byScore {
+		if m.Score < 4 || m.Score > 6 {
+			t.Errorf("%v is out of range", m)
+		}
+	}
+	if limited, _ := d.ZRangeByScore("board", 4, 6, 2); len(limited) != 2 || fmt.Sprint(limited) != fmt.Sprint(byScore[:2]) {
+		t.Errorf("expected %v, got %v", byScore[:2], limited)
+	}
+
+	if s, _ := d.ZIncrBy("board", "new", 2.5); s != 2.5 {
+		t.Errorf("expected 2.5, got %v", s)
+	}
+	if _, err := d.ZAdd("board", map[string]float64{"x": math.Inf(1)}); err == nil {
+		t.Error("infinite score was accepted")
+	}
+}
+
+func TestZSetIsPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	open := func() *DB {
+		d := New(path, false, false, make(chan error, 10), make(chan bool), 0)
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		return d
+	}
+
+	d := open()
+	_, _ = d.ZAdd("board", map[string]float64{"ana": 3, "ivo": 1.5, "eva": 2})
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %s", err)
+	}
+
+	d = open()
+	defer d.Disconnect()
+	if r, _, err := d.ZRank("board", "ana"); err != nil || r != 2 {
+		t.Errorf("expected rank 2, got %d (%v)", r, err)
+	}
+	if all, _ := d.ZRange("board", 0, -1); fmt.Sprint(all) != "[{ivo 1.5} {eva 2} {ana 3}]" {
+		t.Errorf("unexpected members after restart %v", all)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	d := newMemoryDB(t)
+
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				_, _ = d.Incr("hits")
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	if v, _ := d.Read("hits"); v != int64(1000) {
+		t.Errorf("expected 1000 hits, got %v", v)
+	}
+
+	_ = d.Create("json", 41.0)
+	_ = d.Create("tcp", "41")
+	for _, k := range []string{"json", "tcp"} {
+		if n, err := d.IncrBy(k, 1); err != nil || n != 42 {
+			t.Errorf("%s: expected 42, got %d (%v)", k, n, err)
+		}
+	}
+	if n, _ := d.DecrBy("missing", 5); n != -5 {
+		t.Errorf("expected -5, got %d", n)
+	}
+	if f, err := d.IncrByFloat("json", 0.5); err != nil || f != 42.5 {
+		t.Errorf("expected 42.5, got %v (%v)", f, err)
+	}
+	if _, err := d.Incr("json"); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("expected ErrNotInteger, got %v", err)
+	}
+	_ = d.Create("name", "ana")
+	if _, err := d.IncrByFloat("name", 1); !errors.Is(err, ErrNotNumber) {
+		t.Errorf("expected ErrNotNumber, got %v", err)
+	}
+	_, _ = d.RPush("list", "x")
+	if _, err := d.Incr("list"); err != ErrWrongType {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+	_ = d.Create("max", float64(1<<62))
+	if _, err := d.IncrBy("max", math.MaxInt64); err == nil {
+		t.Error("overflow was not detected")
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	d := newMemoryDB(t)
+
+	if _, existed, err := d.Set("k", "a", SetOptions{IfPresent: true}); err != ErrSetCondition || existed {
+		t.Errorf("expected ErrSetCondition for missing key, got %v", err)
+	}
+	if _, existed, err := d.Set("k", "a", SetOptions{IfAbsent: true, TTL: time.Hour}); err != nil || existed {
+		t.Errorf("set if absent failed: %v", err)
+	}
+	if old, _, err := d.Set("k", "b", SetOptions{IfAbsent: true}); err != ErrSetCondition || old != "a" {
+		t.Errorf("expected ErrSetCondition with previous a, got %v (%v)", old, err)
+	}
+	if old, existed, err := d.Set("k", "b", SetOptions{KeepTTL: true}); err != nil || !existed || old != "a" {
+		t.Errorf("expected previous a, got %v (%v)", old, err)
+	}
+	if ttl, _ := d.TTL("k"); ttl <= 0 {
+		t.Error("expiry was not kept")
+	}
+	_, _, _ = d.Set("k", "c", SetOptions{})
+	if ttl, _ := d.TTL("k"); ttl != NoExpiry {
+		t.Errorf("expiry was not cleared, got %v", ttl)
+	}
+	if _, _, err := d.Set("k", "d", SetOptions{IfAbsent: true, IfPresent: true}); err == nil {
+		t.Error("conflicting options were accepted")
+	}
+}
+
+func TestPatchIsAtomic(t *testing.T) {
+	d := newMemoryDB(t)
+	_ = d.Create("doc", map[string]interface{}{"n": 1.0, "tags": []interface{}{"a"}})
+	before, _ := d.Read("doc")
+
+	ops := []document.Operation{}
+	_ = json.Unmarshal([]byte(`[{"op":"add","path":"/tags/-","value":"b"},{"op":"test","path":"/n","value":2}]`), &ops)
+	if _, err := d.JSONPatch("doc", ops); !errors.Is(err, document.ErrTestFailed) {
+		t.Errorf("expected ErrTestFailed, got %v", err)
+	}
+	if v, _ := d.Read("doc"); fmt.Sprint(v) != "map[n:1 tags:[a]]" {
+		t.Errorf("failed patch changed the value to %v", v)
+	}
+
+	_ = json.Unmarshal([]byte(`[{"op":"add","path":"/tags/-","value":"b"},{"op":"test","path":"/n","value":1}]`), &ops)
+	if v, err := d.JSONPatch("doc", ops); err != nil || fmt.Sprint(v) != "map[n:1 tags:[a b]]" {
+		t.Errorf("unexpected patch result %v (%v)", v, err)
+	}
+	if v, err := d.MergePatch("doc", map[string]interface{}{"n": nil, "x": true}); err != nil || fmt.Sprint(v) != "map[tags:[a b] x:true]" {
+		t.Errorf("unexpected merge result %v (%v)", v, err)
+	}
+	if fmt.Sprint(before) != "map[n:1 tags:[a]]" {
+		t.Errorf("patch modified a value read before, got %v", before)
+	}
+	if _, err := d.MergePatch("missing", nil); err == nil {
+		t.Error("missing key was patched")
+	}
+}
+
+func TestReadPath(t *testing.T) {
+	d := newMemoryDB(t)
+	var doc interface{}
+	_ = json.Unmarshal([]byte(`{"settings":{"theme":"dark"},"items":[{"name":"a"},{"name":"b"}]}`), &doc)
+	_ = d.Create("doc", doc)
+	_, _ = d.HSet("hash", "f", "v")
+
+	for path, expected := range map[string]interface{}{
+		"settings.theme": "dark",
+		"/items/1/name":  "b",
+		"items.0.name":   "a",
+	} {
+		p, _ := document.ParsePath(path)
+		if v, err := d.ReadPath("doc", p); err != nil || v != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", path, expected, v, err)
+		}
+	}
+	if v, err := d.ReadPath("hash", document.Pointer{"f"}); err != nil || v != "v" {
+		t.Errorf("expected hash field v, got %v (%v)", v, err)
+	}
+	for _, p := range []document.Pointer{{"settings", "missing"}, {"items", "2"}, {"settings", "theme", "x"}} {
+		if _, err := d.ReadPath("doc", p); err == nil {
+			t.Errorf("%s: expected an error", p)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	d := newMemoryDB(t)
+	user := func(key, name string, age float64) {
+		_ = d.Create(key, map[string]interface{}{"name": name, "age": age})
+	}
+	user("user:1", "ana", 31)
+	user("user:2", "ivo", -4)
+	user("team:1", "ana", 40)
+	if err := d.CreateIndex("age", "user:", "age"); err != nil {
+		t.Fatal(err)
+	}
+	_ = d.CreateIndex("name", "user:", "/name")
+	user("user:3", "eva", 25)
+	user("user:4", "ana", 31)
+	_ = d.Update("user:2", map[string]interface{}{"name": "ivo", "age": 52.5})
+	_ = d.Delete("user:4")
+	_ = d.CreateWithTTL("user:5", map[string]interface{}{"name": "ana", "age": 1.0}, time.Millisecond)
+	_ = d.Create("user:6", "no fields")
+	time.Sleep(5 * time.Millisecond)
+
+	keys := func(entries []Entry, err error) string {
+		if err != nil {
+			return err.Error()
+		}
+		res := []string{}
+		for _, e := range entries {
+			res = append(res, e.Key)
+		}
+		return strings.Join(res, " ")
+	}
+	for expected, got := range map[string]string{
+		"user:1":               keys(d.Find("name", "ana", 0)),
+		"user:3 user:1 user:2": keys(d.FindRange("age", nil, nil, 0)),
+		"user:3 user:1":        keys(d.FindRange("age", 0, 31, 0)),
+		"user:1 user:2":        keys(d.FindRange("age", 30.5, nil, 0)),
+		"user:3":               keys(d.FindRange("age", nil, nil, 1)),
+		"user:1 user:3":        keys(d.FindRange("name", "a", "f", 0)),
+		"":                     keys(d.Find("age", 100, 0)),
+	} {
+		if got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+
+	if err := d.CreateIndex("age", "x", "y"); err == nil {
+		t.Error("expected duplicate index to fail")
+	}
+	if _, err := d.Find("age", []interface{}{}, 0); err != ErrNotIndexable {
+		t.Errorf("expected ErrNotIndexable, got %v", err)
+	}
+	_ = d.DropIndex("name")
+	if _, err := d.Find("name", "ana", 0); err == nil {
+		t.Error("expected dropped index to be gone")
+	}
+}
+
+func TestIndexIsPersisted(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithAppendOnly(write.FsyncAlways)}} {
+		path := filepath.Join(t.TempDir(), "db.json")
+		open := func() *DB {
+			d := New(path, false, false, make(chan error, 10), make(chan bool), 0, opts...)
+			if err := d.Connect(); err != nil {
+				t.Fatalf("connect failed: %s", err)
+			}
+			return d
+		}
+
+		d := open()
+		_ = d.CreateIndex("age", "user:", "age")
+		_ = d.CreateIndex("old", "user:", "name")
+		_ = d.Create("user:1", map[string]interface{}{"age": 31.0})
+		_ = d.DropIndex("old")
+		if err := d.Disconnect(); err != nil {
+			t.Fatalf("disconnect failed: %s", err)
+		}
+
+		d = open()
+		if idx := d.Indexes(); fmt.Sprint(idx) != "[{age user: age}]" {
+			t.Errorf("unexpected indexes after restart %v", idx)
+		}
+		if entries, err := d.Find("age", 31, 0); err != nil || len(entries) != 1 {
+			t.Errorf("expected user:1, got %v (%v)", entries, err)
+		}
+		_ = d.Disconnect()
+	}
+}
+
+func TestQuery(t *testing.T) {
+	d := newMemoryDB(t)
+	for i := 0; i < 30; i++ {
+		status := "open"
+		if i%3 == 0 {
+			status = "closed"
+		}
+		_ = d.Create(fmt.Sprintf("order:%02d", i), map[string]interface{}{"status": status, "total": float64(i * 10)})
+	}
+	_ = d.Create("user:1", map[string]interface{}{"status": "open", "total": 500.0})
+	_, _ = d.HSet("order:hash", "status", "open")
+	_, _ = d.SAdd("order:set", "open")
+
+	q, err := query.Parse(`from order:* where status == "open" and total > 100 select total limit 4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for pages := 0; pages < 10; pages++ {
+		entries, next, err := d.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) > 4 {
+			t.Errorf("page has %d results, limit is 4", len(entries))
+		}
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+			if total, _ := e.Value.(map[string]interface{})["total"].(float64); total <= 100 {
+				t.Errorf("%s: unexpected total %v", e.Key, e.Value)
+			}
+		}
+		if next == CursorStart {
+			break
+		}
+		q.Cursor = next
+	}
+	if expected := "order:11 order:13 order:14 order:16 order:17 order:19 order:20 order:22 order:23 order:25 order:26 order:28 order:29"; strings.Join(keys, " ") != expected {
+		t.Errorf("expected %s, got %v", expected, keys)
+	}
+
+	q, _ = query.Parse(`from order:[h-s]* where $key != "order:x"`)
+	if entries, _, _ := d.Query(q); len(entries) != 2 {
+		t.Errorf("expected the hash and set, got %v", entries)
+	}
+	q, _ = query.Parse(`where status == "open" limit 5000`)
+	if _, _, err := d.Query(q); err == nil {
+		t.Error("expected limit over MaxQueryLimit to fail")
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	open := func(policy EvictionPolicy) *DB {
+		d := New("", true, false, make(chan error, 10), make(chan bool), 0, WithMaxMemory(2000, policy))
+		if err := d.Connect(); err != nil {
+			t.Fatalf("connect failed: %s", err)
+		}
+		t.Cleanup(func() { _ = d.Disconnect() })
+		return d
+	}
+	value := strings.Repeat("x", 100)
+
+	d := open(NoEviction)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = d.Create(fmt.Sprintf("k%d", i), value)
+	}
+	if err != ErrOutOfMemory {
+		t.Fatalf("expected ErrOutOfMemory, got %v", err)
+	}
+	if _, err := d.RPush("list", "x"); err != ErrOutOfMemory {
+		t.Errorf("expected push to be rejected, got %v", err)
+	}
+	for _, k := range d.Scan("", "", "", 0) {
+		if err := d.Delete(k.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := d.MemoryStats(); m.UsedMemory != 0 || m.Rejected != 2 || m.Evicted != 0 {
+		t.Errorf("unexpected stats after deleting all keys %+v", m)
+	}
+
+	d = open(AllKeysLRU)
+	for i := 0; i < 200; i++ {
+		if err := d.Create(fmt.Sprintf("k%d", i), value); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = d.Read("k0")
+	}
+	m := d.MemoryStats()
+	if m.UsedMemory > m.MaxMemory+300 || m.Evicted == 0 || m.Keys+int(m.Evicted) != 200 {
+		t.Errorf("unexpected stats %+v", m)
+	}
+	if _, err := d.Read("k0"); err != nil {
+		t.Error("recently used key was evicted")
+	}
+
+	d = open(VolatileTTL)
+	for i := 0; i < 10; i++ {
+		_ = d.Create(fmt.Sprintf("keep%d", i), value)
+	}
+	_ = d.CreateWithTTL("soon", value, time.Minute)
+	_ = d.CreateWithTTL("later", value, time.Hour)
+	for i := 0; i < 5 && err == nil; i++ {
+		err = d.Create(fmt.Sprintf("more%d", i), value)
+	}
+	if err != ErrOutOfMemory {
+		t.Errorf("expected ErrOutOfMemory once volatile keys are gone, got %v", err)
+	}
+	if _, err := d.Read("keep0"); err != nil {
+		t.Error("key without expiry was evicted")
+	}
+	if _, err := d.Read("soon"); err == nil {
+		t.Error("expected key closest to expiring to be evicted")
+	}
+}
+
+func TestStateIsIsolated(t *testing.T) {
+	for _, name := range engine.Names() {
+		factory, _ := engine.Factory(name)
+		d := New("", true, false, make(chan error, 10), make(chan bool), 0, WithEngine(factory))
+		_ = d.Create("a", "old")
+		_ = d.CreateWithTTL("b", "old", time.Hour)
+		unlock := d.rlockAll()
+		s := d.state()
+		unlock()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				_, _, _ = d.Set(fmt.Sprintf("k%d", i%10), i, SetOptions{})
+			}
+		}()
+		_ = d.Update("a", "new")
+		_ = d.Delete("b")
+		_, _ = d.HSet("c", "x", "y")
+		for i := 0; i < 10; i++ {
+			s.writeData(changes{all: true})
+		}
+		<-done
+
+		data, expires, versions := map[string]interface{}{}, map[string]time.Time{}, map[string]uint64{}
+		for _, seg := range s.writeData(changes{all: true}).Segments {
+			for k, v := range seg.Data {
+				data[k], versions[k] = v, seg.Versions[k]
+			}
+			for k, exp := range seg.Expires {
+				expires[k] = exp
+			}
+		}
+		if len(data) != 2 || data["a"] != "old" || data["b"] != "old" {
+			t.Errorf("%s: state changed after it was taken %v", name, data)
+		}
+		if _, ok := expires["b"]; !ok || versions["a"] != 1 {
+			t.Errorf("%s: expected expiry and version at the time state was taken, got %v %v", name, expires, versions)
+		}
+	}
+}
+
+func TestShardedMultiKeyOps(t *testing.T) {
+	d := newMemoryDB(t)
+	accounts := make([]string, 20)
+	for i := range accounts {
+		accounts[i] = fmt.Sprintf("account:%d", i)
+		_ = d.Create(accounts[i], int64(100))
+	}
+	if d.shardIndex(accounts[0]) == d.shardIndex(accounts[1]) && d.shardIndex(accounts[0]) == d.shardIndex(accounts[2]) {
+		t.Fatal("expected keys in different shards")
+	}
+
+	// transfers between keys in different shards must never be seen half done
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				from, to := accounts[(w+i)%len(accounts)], accounts[(w+i*7+1)%len(accounts)]
+				err := d.Txn(func(tx *Tx) error {
+					a, _ := tx.Read(from)
+					b, _ := tx.Read(to)
+					_ = tx.Update(from, a.(int64)-1)
+					return tx.Update(to, b.(int64)+1)
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, _ = d.Incr(fmt.Sprintf("counter:%d", i%10))
+			}
+		}(w)
+	}
+	for i := 0; i < 200; i++ {
+		total := int64(0)
+		for _, v := range d.ReadMany(accounts...) {
+			total += v.(int64)
+		}
+		if total != 100*int64(len(accounts)) {
+			t.Fatalf("read a partial transfer, total is %d", total)
+		}
+	}
+	wg.Wait()
+
+	total := int64(0)
+	for i := 0; i < 10; i++ {
+		v, _ := d.Read(fmt.Sprintf("counter:%d", i))
+		total += v.(int64)
+	}
+	if total != 4*200 {
+		t.Errorf("expected 800 increments, got %d", total)
+	}
+
+	_, _ = d.SAdd("a", "x", "y")
+	_, _ = d.SAdd("b", "y", "z")
+	if n, err := d.SUnionStore("dest", "a", "b", "dest"); err != nil || n != 3 {
+		t.Errorf("expected union of 3 members, got %d %v", n, err)
+	}
+	res := d.DeleteMany("a", "b", "a", "missing")
+	if len(res) != 3 || len(d.ReadMany("a", "b")) != 2 {
+		t.Errorf("unexpected delete result %v", res)
+	}
+	if n := len(d.Scan("", "", "", 0)); n != len(accounts)+10+1 {
+		t.Errorf("expected %d keys, got %d", len(accounts)+11, n)
+	}
+}
+
+// benchmarkParallel runs op on random keys from all goroutines, run with -cpu 1,2,4,8 to see how throughput
+// scales with GOMAXPROCS. A single shard shows the throughput of one lock shared by all operations
+func benchmarkParallel(b *testing.B, op func(d *DB, key string, i int)) {
+	for _, shards := range []int{1, DefaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			d := New("", true, false, make(chan error, 10), make(chan bool), 0, WithShards(shards))
+			keys := make([]string, 10000)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key:%d", i)
+				_ = d.Create(keys[i], i)
+			}
+			var seed int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+				for i := 0; pb.Next(); i++ {
+					op(d, keys[r.Intn(len(keys))], i)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	benchmarkParallel(b, func(d *DB, key string, _ int) {
+		_, _ = d.Read(key)
+	})
+}
+
+func BenchmarkWrite(b *testing.B) {
+	benchmarkParallel(b, func(d *DB, key string, i int) {
+		_ = d.Update(key, i)
+	})
+}
+
+// BenchmarkMixed writes one in ten operations, like a read heavy HTTP workload
+func BenchmarkMixed(b *testing.B) {
+	benchmarkParallel(b, func(d *DB, key string, i int) {
+		if i%10 == 0 {
+			_ = d.Update(key, i)
+			return
+		}
+		_, _ = d.Read(key)
+	})
+}
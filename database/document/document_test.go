@@ -0,0 +1,137 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %s", s, err)
+	}
+	return v
+}
+
+func TestPatch(t *testing.T) {
+	for _, c := range []struct {
+		doc, patch, expected string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":null}]`, `{"baz":null}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a/b":{"m~n":1}}`, `[{"op":"copy","from":"/a~1b/m~0n","path":"/c"}]`, `{"a/b":{"m~n":1},"c":1}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	} {
+		var ops []Operation
+		if err := json.Unmarshal([]byte(c.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		res, err := Patch(decode(t, c.doc), ops)
+		if err != nil {
+			t.Errorf("%s: %s", c.patch, err)
+			continue
+		}
+		if !Equal(res, decode(t, c.expected)) {
+			got, _ := json.Marshal(res)
+			t.Errorf("%s: expected %s, got %s", c.patch, c.expected, got)
+		}
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	for _, c := range []struct {
+		patch string
+		err   error
+	}{
+		{`[{"op":"add","path":"/a","value":1},{"op":"test","path":"/a","value":2}]`, ErrTestFailed},
+		{`[{"op":"add","path":"/missing/a","value":1}]`, nil},
+		{`[{"op":"add","path":"/list/5","value":1}]`, nil},
+		{`[{"op":"add","path":"/list/01","value":1}]`, nil},
+		{`[{"op":"add","path":"/a"}]`, nil},
+		{`[{"op":"remove","path":"/nope"}]`, nil},
+		{`[{"op":"move","from":"/obj","path":"/obj/inner"}]`, nil},
+		{`[{"op":"frobnicate","path":"/a"}]`, nil},
+	} {
+		doc := decode(t, `{"list":[1,2],"obj":{}}`)
+		var ops []Operation
+		if err := json.Unmarshal([]byte(c.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Patch(doc, ops)
+		var opErr *OpError
+		if !errors.As(err, &opErr) || (c.err != nil && !errors.Is(err, c.err)) {
+			t.Errorf("%s: unexpected error %v", c.patch, err)
+		}
+		if !Equal(doc, decode(t, `{"list":[1,2],"obj":{}}`)) {
+			t.Errorf("%s: failed patch changed the document", c.patch)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, c := range []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		doc := decode(t, c.doc)
+		res := MergePatch(doc, decode(t, c.patch))
+		if !Equal(res, decode(t, c.expected)) {
+			got, _ := json.Marshal(res)
+			t.Errorf("%s + %s: expected %s, got %s", c.doc, c.patch, c.expected, got)
+		}
+		if !Equal(doc, decode(t, c.doc)) {
+			t.Errorf("%s + %s: document was changed", c.doc, c.patch)
+		}
+	}
+}
+
+func TestPointer(t *testing.T) {
+	doc := decode(t, `{"foo":["bar","baz"],"":0,"a/b":1,"m~n":8}`)
+	for ptr, expected := range map[string]string{
+		"":       `{"foo":["bar","baz"],"":0,"a/b":1,"m~n":8}`,
+		"/foo/0": `"bar"`,
+		"/":      `0`,
+		"/a~1b":  `1`,
+		"/m~0n":  `8`,
+	} {
+		p, err := ParsePointer(ptr)
+		if err != nil {
+			t.Errorf("%q: %s", ptr, err)
+			continue
+		}
+		if v, err := p.Get(doc); err != nil || !Equal(v, decode(t, expected)) {
+			t.Errorf("%q: expected %s, got %v (%v)", ptr, expected, v, err)
+		}
+		if p.String() != ptr {
+			t.Errorf("%q formatted as %q", ptr, p.String())
+		}
+	}
+	for _, ptr := range []string{"foo", "/a~2", "/foo/2", "/foo/-1"} {
+		p, err := ParsePointer(ptr)
+		if err == nil {
+			_, err = p.Get(doc)
+		}
+		if err == nil {
+			t.Errorf("%q: expected an error", ptr)
+		}
+	}
+}
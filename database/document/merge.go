@@ -0,0 +1,27 @@
+package document
+
+// MergePatch applies an RFC 7396 merge patch to doc and returns the result, doc is left unchanged.
+// Members of patch objects replace members of doc objects, nulls remove them and any other patch replaces doc as a whole
+func MergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return Copy(patch)
+	}
+	target, ok := doc.(map[string]interface{})
+	if !ok {
+		target = map[string]interface{}{}
+	}
+
+	res := make(map[string]interface{}, len(target))
+	for k, v := range target {
+		res[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(res, k)
+			continue
+		}
+		res[k] = MergePatch(res[k], v)
+	}
+	return res
+}
@@ -0,0 +1,275 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrTestFailed is returned when a test operation of a patch doesn't match
+var ErrTestFailed = errors.New("test failed")
+
+// Operation is a single JSON Patch operation: add, remove, replace, move, copy or test
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	// hasValue tells a null value apart from a missing one
+	hasValue bool
+}
+
+// UnmarshalJSON decodes an operation, noting whether it has a value
+func (o *Operation) UnmarshalJSON(b []byte) error {
+	type operation Operation
+	var op operation
+	if err := json.Unmarshal(b, &op); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	*o = Operation(op)
+	_, o.hasValue = fields["value"]
+	return nil
+}
+
+// OpError is returned by Patch when an operation fails
+type OpError struct {
+	// Index of the operation in the patch
+	Index int
+	Op    Operation
+	Err   error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("op %d (%s %s): %v", e.Index, e.Op.Op, e.Op.Path, e.Err)
+}
+
+// Unwrap returns the cause of the failure
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Patch applies ops to a copy of doc and returns it. If any operation fails, including a test, an *OpError is returned
+// and doc is left unchanged
+func Patch(doc interface{}, ops []Operation) (interface{}, error) {
+	doc = Copy(doc)
+	for i, op := range ops {
+		var err error
+		if doc, err = apply(doc, op); err != nil {
+			return nil, &OpError{Index: i, Op: op, Err: err}
+		}
+	}
+	return doc, nil
+}
+
+func apply(doc interface{}, op Operation) (interface{}, error) {
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !op.hasValue && (op.Op == "add" || op.Op == "replace" || op.Op == "test") {
+		return nil, errors.New("missing value")
+	}
+
+	switch op.Op {
+	case "add":
+		return add(doc, path, Copy(op.Value))
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		if _, err := path.Get(doc); err != nil {
+			return nil, err
+		}
+		return set(doc, path, Copy(op.Value))
+	case "move", "copy":
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := from.Get(doc)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return add(doc, path, Copy(v))
+		}
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, errors.New("can't move a value into itself")
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "test":
+		v, err := path.Get(doc)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(v, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// add inserts v at p, replacing object members and shifting array elements. Token - appends to an array
+func add(doc interface{}, p Pointer, v interface{}) (interface{}, error) {
+	if len(p) == 0 {
+		return v, nil
+	}
+	pp, last := p.parent()
+	parent, err := pp.Get(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = v
+		return doc, nil
+	case []interface{}:
+		i := len(c)
+		if last != "-" {
+			if i, err = index(last, len(c)+1); err != nil {
+				return nil, err
+			}
+		}
+		arr := make([]interface{}, 0, len(c)+1)
+		arr = append(append(append(arr, c[:i]...), v), c[i:]...)
+		return set(doc, pp, arr)
+	}
+	return nil, fmt.Errorf("%s is not an object or array", pp)
+}
+
+// remove deletes the value at p, shifting following array elements
+func remove(doc interface{}, p Pointer) (interface{}, error) {
+	if len(p) == 0 {
+		return nil, errors.New("can't remove the whole document")
+	}
+	pp, last := p.parent()
+	parent, err := pp.Get(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := c[last]; !ok {
+			return nil, fmt.Errorf("%s doesn't exist", p)
+		}
+		delete(c, last)
+		return doc, nil
+	case []interface{}:
+		i, err := index(last, len(c))
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]interface{}, 0, len(c)-1)
+		arr = append(append(arr, c[:i]...), c[i+1:]...)
+		return set(doc, pp, arr)
+	}
+	return nil, fmt.Errorf("%s is not an object or array", pp)
+}
+
+// set replaces the value at p, which must point into an existing object or array
+func set(doc interface{}, p Pointer, v interface{}) (interface{}, error) {
+	if len(p) == 0 {
+		return v, nil
+	}
+	pp, last := p.parent()
+	parent, err := pp.Get(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = v
+		return doc, nil
+	case []interface{}:
+		i, err := index(last, len(c))
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%s is not an object or array", pp)
+}
+
+// Copy returns a deep copy of objects and arrays in v, other values are returned as they are
+func Copy(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+		for k, v := range c {
+			m[k] = Copy(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(c))
+		for i, v := range c {
+			a[i] = Copy(v)
+		}
+		return a
+	}
+	return v
+}
+
+// Equal compares JSON values, numbers are equal if they have the same value whatever their type
+func Equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !Equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := Number(a); ok {
+		y, ok := Number(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+// Number converts numeric JSON values and integers stored by counters to float64, so they're compared the same way
+func Number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// ParseValue parses s as a JSON value, text which isn't valid JSON is returned as a string
+func ParseValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
@@ -0,0 +1,89 @@
+// Package document reads and changes JSON documents decoded into interface{} values,
+// using JSON Pointers (RFC 6901), JSON Patch (RFC 6902) and JSON Merge Patch (RFC 7396)
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pointer is a parsed JSON Pointer, the list of reference tokens leading to a value. An empty pointer is the whole document
+type Pointer []string
+
+// ParsePointer parses a JSON Pointer like /users/0/name, where ~1 stands for / and ~0 for ~
+func ParsePointer(s string) (Pointer, error) {
+	if s == "" {
+		return Pointer{}, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("invalid pointer %q, it must start with /", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(t), "~") {
+			return nil, fmt.Errorf("invalid pointer %q, ~ must be followed by 0 or 1", s)
+		}
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return Pointer(tokens), nil
+}
+
+// ParsePath parses either a JSON Pointer or a dot separated path like users.0.name.
+// Members containing dots can only be reached with a pointer
+func ParsePath(s string) (Pointer, error) {
+	if s == "" || s[0] == '/' {
+		return ParsePointer(s)
+	}
+	return Pointer(strings.Split(s, ".")), nil
+}
+
+// String formats p back to a JSON Pointer
+func (p Pointer) String() string {
+	var b strings.Builder
+	for _, t := range p {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(t))
+	}
+	return b.String()
+}
+
+// Get returns the value p points to in doc
+func (p Pointer) Get(doc interface{}) (interface{}, error) {
+	v := doc
+	for i, t := range p {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = c[t]; !ok {
+				return nil, fmt.Errorf("%s doesn't exist", p[:i+1])
+			}
+		case []interface{}:
+			idx, err := index(t, len(c))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", p[:i+1], err)
+			}
+			v = c[idx]
+		default:
+			return nil, fmt.Errorf("%s doesn't exist, %s is not an object or array", p[:i+1], p[:i])
+		}
+	}
+	return v, nil
+}
+
+// parent returns the pointer to the value containing the one p points to, and p's last token
+func (p Pointer) parent() (Pointer, string) {
+	return p[:len(p)-1], p[len(p)-1]
+}
+
+// index parses an array index token which must point to one of n elements
+func index(t string, n int) (int, error) {
+	i, err := strconv.Atoi(t)
+	if err != nil || i < 0 || (len(t) > 1 && t[0] == '0') || t[0] == '+' {
+		return 0, fmt.Errorf("invalid array index %q", t)
+	}
+	if i >= n {
+		return 0, fmt.Errorf("index %d is out of range", i)
+	}
+	return i, nil
+}
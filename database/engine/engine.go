@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Engine stores the key/value pairs behind a database.
+// Engines don't need to be safe for concurrent writes, the database locks them while they're written.
+// Reads can run in parallel, so Get and Iterate must not change the engine
+type Engine interface {
+	// Get returns the value stored under key
+	Get(key string) (interface{}, bool)
+	// Put stores value under key, replacing any previous value
+	Put(key string, value interface{})
+	// Delete removes key and reports whether it existed
+	Delete(key string) bool
+	// Len returns the number of stored keys
+	Len() int
+	// Iterate calls fn for every key/value pair until fn returns false
+	Iterate(fn func(key string, value interface{}) bool)
+	// Snapshot returns a point in time copy of the engine which is not affected by later changes.
+	// It's taken while the database is locked, so engines should make it cheap, ideally constant time
+	Snapshot() Engine
+}
+
+// Default is the name of the engine used when none is picked
+const Default = "hamt"
+
+var engines = map[string]func() Engine{
+	"hamt": func() Engine { return NewHAMT() },
+	"map":  func() Engine { return NewMap() },
+	"tree": func() Engine { return NewTree() },
+}
+
+// Register makes an engine available under name
+func Register(name string, factory func() Engine) {
+	engines[name] = factory
+}
+
+// New creates a new empty engine registered under name
+func New(name string) (Engine, error) {
+	factory, err := Factory(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(), nil
+}
+
+// Factory returns the function creating engines registered under name
+func Factory(name string) (func() Engine, error) {
+	factory, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q, must be one of %s", name, strings.Join(Names(), ", "))
+	}
+	return factory, nil
+}
+
+// Names returns names of all registered engines
+func Names() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ToMap copies all entries of e into a map
+func ToMap(e Engine) map[string]interface{} {
+	m := make(map[string]interface{}, e.Len())
+	e.Iterate(func(k string, v interface{}) bool {
+		m[k] = v
+		return true
+	})
+	return m
+}
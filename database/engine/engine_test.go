@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestEnginesMatchReference(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			e, _ := New(name)
+			ref := map[string]interface{}{}
+			r := rand.New(rand.NewSource(1))
+
+			for i := 0; i < 5000; i++ {
+				k := strconv.Itoa(r.Intn(500))
+				if r.Intn(3) == 0 {
+					_, existed := ref[k]
+					if e.Delete(k) != existed {
+						t.Fatalf("delete %s reported wrong existence", k)
+					}
+					delete(ref, k)
+				} else {
+					e.Put(k, i)
+					ref[k] = i
+				}
+			}
+
+			if e.Len() != len(ref) {
+				t.Fatalf("expected %d keys, got %d", len(ref), e.Len())
+			}
+			snap := e.Snapshot()
+			e.Put("after-snapshot", true)
+			for k, v := range ref {
+				if got, ok := snap.Get(k); !ok || got != v {
+					t.Errorf("%s: expected %v, got %v", k, v, got)
+				}
+			}
+			if _, ok := snap.Get("after-snapshot"); ok {
+				t.Error("snapshot changed after it was taken")
+			}
+		})
+	}
+}
+
+func TestTreeIteratesInOrder(t *testing.T) {
+	tr := NewTree()
+	keys := []string{"b", "a:2", "c", "a:1", "a", "ba"}
+	for _, k := range keys {
+		tr.Put(k, nil)
+	}
+	sort.Strings(keys)
+
+	got := []string{}
+	tr.Iterate(func(k string, _ interface{}) bool {
+		got = append(got, k)
+		return true
+	})
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Fatalf("expected %v, got %v", keys, got)
+		}
+	}
+
+	got = got[:0]
+	tr.Ascend("a:", func(k string, _ interface{}) bool {
+		got = append(got, k)
+		return len(got) < 3
+	})
+	if len(got) != 3 || got[0] != "a:1" || got[2] != "b" {
+		t.Errorf("unexpected ascend result %v", got)
+	}
+}
+
+func TestSnapshotsDontChange(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			e, _ := New(name)
+			ref := map[string]interface{}{}
+			r := rand.New(rand.NewSource(2))
+
+			type snapshot struct {
+				e   Engine
+				ref map[string]interface{}
+			}
+			snaps := []snapshot{}
+			for i := 0; i < 3000; i++ {
+				k := strconv.Itoa(r.Intn(300))
+				if r.Intn(3) == 0 {
+					e.Delete(k)
+					delete(ref, k)
+				} else {
+					e.Put(k, i)
+					ref[k] = i
+				}
+				if i%300 == 0 {
+					copied := make(map[string]interface{}, len(ref))
+					for k, v := range ref {
+						copied[k] = v
+					}
+					snaps = append(snaps, snapshot{e.Snapshot(), copied})
+				}
+			}
+
+			for i, s := range snaps {
+				if s.e.Len() != len(s.ref) {
+					t.Fatalf("snapshot %d: expected %d keys, got %d", i, len(s.ref), s.e.Len())
+				}
+				s.e.Iterate(func(k string, v interface{}) bool {
+					if s.ref[k] != v {
+						t.Fatalf("snapshot %d: %s is %v, expected %v", i, k, v, s.ref[k])
+					}
+					return true
+				})
+			}
+		})
+	}
+}
+
+func TestHAMTHashCollisions(t *testing.T) {
+	root := &hamtNode{}
+	// keys with equal hashes share a leaf, keys with hashes equal in the first 50 bits share a long path
+	for _, c := range []struct {
+		hash uint64
+		key  string
+	}{{42, "a"}, {42, "b"}, {42 | 1<<50, "c"}, {7, "d"}} {
+		root, _ = root.put(0, c.hash, c.key, c.key)
+	}
+	h := &HAMT{root: root, size: 4}
+	got := map[string]bool{}
+	h.Iterate(func(k string, _ interface{}) bool {
+		got[k] = true
+		return true
+	})
+	if len(got) != 4 {
+		t.Fatalf("expected 4 keys, got %v", got)
+	}
+
+	root, ok := root.remove(0, 42, "a")
+	if !ok {
+		t.Fatal("expected a to be removed")
+	}
+	if _, ok := root.remove(0, 42, "a"); ok {
+		t.Error("removed a twice")
+	}
+	root, _ = root.remove(0, 42, "b")
+	root, _ = root.remove(0, 42|1<<50, "c")
+	// the long path is collapsed once only d is left
+	if len(root.children) != 1 {
+		t.Fatalf("expected a single child, got %d", len(root.children))
+	}
+	if leaf, ok := root.children[0].(*hamtLeaf); !ok || leaf.entries[0].key != "d" {
+		t.Errorf("expected leaf d, got %#v", root.children[0])
+	}
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+// HAMT is an unordered engine backed by a persistent hash array mapped trie. Nodes are never changed once created,
+// every change copies the path to the changed key instead, so Snapshot only copies the root
+type HAMT struct {
+	root *hamtNode
+	size int
+	seed maphash.Seed
+}
+
+// hamtNode holds up to 32 children, one per 5 bits of key hashes at it's depth. The bitmap has a bit set for
+// every child present, children are kept in bit order
+type hamtNode struct {
+	bitmap   uint32
+	children []interface{} // *hamtNode or *hamtLeaf
+}
+
+// hamtLeaf holds all keys with the same hash, usually just one
+type hamtLeaf struct {
+	hash    uint64
+	entries []hamtEntry
+}
+
+type hamtEntry struct {
+	key   string
+	value interface{}
+}
+
+// NewHAMT returns an empty HAMT engine
+func NewHAMT() *HAMT {
+	return &HAMT{root: &hamtNode{}, seed: maphash.MakeSeed()}
+}
+
+func (h *HAMT) hash(key string) uint64 {
+	var mh maphash.Hash
+	mh.SetSeed(h.seed)
+	_, _ = mh.WriteString(key)
+	return mh.Sum64()
+}
+
+func (h *HAMT) Get(key string) (interface{}, bool) {
+	hash := h.hash(key)
+	n := h.root
+	for shift := uint(0); ; shift += hamtBits {
+		bit, idx := n.slot(shift, hash)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		switch c := n.children[idx].(type) {
+		case *hamtNode:
+			n = c
+		case *hamtLeaf:
+			if c.hash != hash {
+				return nil, false
+			}
+			for _, e := range c.entries {
+				if e.key == key {
+					return e.value, true
+				}
+			}
+			return nil, false
+		}
+	}
+}
+
+func (h *HAMT) Put(key string, value interface{}) {
+	var added bool
+	h.root, added = h.root.put(0, h.hash(key), key, value)
+	if added {
+		h.size++
+	}
+}
+
+func (h *HAMT) Delete(key string) bool {
+	root, ok := h.root.remove(0, h.hash(key), key)
+	if !ok {
+		return false
+	}
+	if root == nil {
+		root = &hamtNode{}
+	}
+	h.root = root
+	h.size--
+	return true
+}
+
+func (h *HAMT) Len() int {
+	return h.size
+}
+
+// Iterate visits keys in no particular order. Changes made while iterating don't affect the keys visited
+func (h *HAMT) Iterate(fn func(key string, value interface{}) bool) {
+	h.root.iterate(fn)
+}
+
+// Snapshot returns a copy sharing all nodes with h, it takes constant time
+func (h *HAMT) Snapshot() Engine {
+	c := *h
+	return &c
+}
+
+// Random returns a random key and it's value, or false if h is empty. Keys in sparse parts of the trie
+// are picked more often, so it's only good enough for sampling. Intn returns a random number in [0, n)
+func (h *HAMT) Random(intn func(n int) int) (string, interface{}, bool) {
+	n := h.root
+	for len(n.children) > 0 {
+		switch c := n.children[intn(len(n.children))].(type) {
+		case *hamtNode:
+			n = c
+		case *hamtLeaf:
+			e := c.entries[intn(len(c.entries))]
+			return e.key, e.value, true
+		}
+	}
+	return "", nil, false
+}
+
+// slot returns the bitmap bit of hash at shift and the index of it's child
+func (n *hamtNode) slot(shift uint, hash uint64) (uint32, int) {
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// put returns a copy of n with key set to value and whether key is new
+func (n *hamtNode) put(shift uint, hash uint64, key string, value interface{}) (*hamtNode, bool) {
+	bit, idx := n.slot(shift, hash)
+	if n.bitmap&bit == 0 {
+		children := make([]interface{}, len(n.children)+1)
+		copy(children, n.children[:idx])
+		children[idx] = &hamtLeaf{hash: hash, entries: []hamtEntry{{key, value}}}
+		copy(children[idx+1:], n.children[idx:])
+		return &hamtNode{bitmap: n.bitmap | bit, children: children}, true
+	}
+
+	switch c := n.children[idx].(type) {
+	case *hamtNode:
+		sub, added := c.put(shift+hamtBits, hash, key, value)
+		return n.with(idx, sub), added
+	case *hamtLeaf:
+		if c.hash == hash {
+			leaf, added := c.put(key, value)
+			return n.with(idx, leaf), added
+		}
+		// different hashes always differ in some of the following bits, so the split ends before hashes run out
+		next := shift + hamtBits
+		sub := &hamtNode{bitmap: 1 << ((c.hash >> next) & hamtMask), children: []interface{}{c}}
+		sub, _ = sub.put(next, hash, key, value)
+		return n.with(idx, sub), true
+	}
+	return n, false
+}
+
+// remove returns a copy of n without key, nil if nothing is left, and whether key existed
+func (n *hamtNode) remove(shift uint, hash uint64, key string) (*hamtNode, bool) {
+	bit, idx := n.slot(shift, hash)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	var child interface{}
+	switch c := n.children[idx].(type) {
+	case *hamtNode:
+		sub, ok := c.remove(shift+hamtBits, hash, key)
+		if !ok {
+			return n, false
+		}
+		if sub != nil {
+			child = sub
+			// a node left with a single leaf is replaced by the leaf, keeping the trie shallow
+			if leaf, isLeaf := sub.children[0].(*hamtLeaf); isLeaf && len(sub.children) == 1 {
+				child = leaf
+			}
+		}
+	case *hamtLeaf:
+		if c.hash != hash {
+			return n, false
+		}
+		leaf, ok := c.remove(key)
+		if !ok {
+			return n, false
+		}
+		if leaf != nil {
+			child = leaf
+		}
+	}
+
+	if child != nil {
+		return n.with(idx, child), true
+	}
+	if len(n.children) == 1 {
+		return nil, true
+	}
+	children := make([]interface{}, len(n.children)-1)
+	copy(children, n.children[:idx])
+	copy(children[idx:], n.children[idx+1:])
+	return &hamtNode{bitmap: n.bitmap &^ bit, children: children}, true
+}
+
+// with returns a copy of n with the child at idx replaced
+func (n *hamtNode) with(idx int, child interface{}) *hamtNode {
+	children := make([]interface{}, len(n.children))
+	copy(children, n.children)
+	children[idx] = child
+	return &hamtNode{bitmap: n.bitmap, children: children}
+}
+
+func (n *hamtNode) iterate(fn func(key string, value interface{}) bool) bool {
+	for _, c := range n.children {
+		switch c := c.(type) {
+		case *hamtNode:
+			if !c.iterate(fn) {
+				return false
+			}
+		case *hamtLeaf:
+			for _, e := range c.entries {
+				if !fn(e.key, e.value) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// put returns a copy of l with key set to value and whether key is new
+func (l *hamtLeaf) put(key string, value interface{}) (*hamtLeaf, bool) {
+	entries := make([]hamtEntry, len(l.entries), len(l.entries)+1)
+	copy(entries, l.entries)
+	for i, e := range entries {
+		if e.key == key {
+			entries[i].value = value
+			return &hamtLeaf{hash: l.hash, entries: entries}, false
+		}
+	}
+	return &hamtLeaf{hash: l.hash, entries: append(entries, hamtEntry{key, value})}, true
+}
+
+// remove returns a copy of l without key, nil if nothing is left, and whether key existed
+func (l *hamtLeaf) remove(key string) (*hamtLeaf, bool) {
+	for i, e := range l.entries {
+		if e.key != key {
+			continue
+		}
+		if len(l.entries) == 1 {
+			return nil, true
+		}
+		entries := make([]hamtEntry, 0, len(l.entries)-1)
+		entries = append(entries, l.entries[:i]...)
+		entries = append(entries, l.entries[i+1:]...)
+		return &hamtLeaf{hash: l.hash, entries: entries}, true
+	}
+	return l, false
+}
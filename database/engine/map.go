@@ -0,0 +1,45 @@
+package engine
+
+// Map is an unordered engine backed by a go map
+type Map struct {
+	m map[string]interface{}
+}
+
+// NewMap returns an empty map engine
+func NewMap() *Map {
+	return &Map{m: make(map[string]interface{})}
+}
+
+func (e *Map) Get(key string) (interface{}, bool) {
+	v, ok := e.m[key]
+	return v, ok
+}
+
+func (e *Map) Put(key string, value interface{}) {
+	e.m[key] = value
+}
+
+func (e *Map) Delete(key string) bool {
+	if _, ok := e.m[key]; !ok {
+		return false
+	}
+	delete(e.m, key)
+	return true
+}
+
+func (e *Map) Len() int {
+	return len(e.m)
+}
+
+func (e *Map) Iterate(fn func(key string, value interface{}) bool) {
+	for k, v := range e.m {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Snapshot copies the whole map, use HAMT for constant time snapshots
+func (e *Map) Snapshot() Engine {
+	return &Map{m: ToMap(e)}
+}
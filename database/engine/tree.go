@@ -0,0 +1,186 @@
+package engine
+
+// Tree is an engine backed by an AVL tree which keeps keys in lexicographic order.
+// The tree is persistent, changes copy the path to the changed key instead of modifying nodes, so Snapshot only copies the root
+type Tree struct {
+	root *node
+	size int
+}
+
+type node struct {
+	key         string
+	value       interface{}
+	left, right *node
+	height      int
+}
+
+// NewTree returns an empty tree engine
+func NewTree() *Tree {
+	return &Tree{}
+}
+
+func (t *Tree) Get(key string) (interface{}, bool) {
+	n := t.root
+	for n != nil {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n.value, true
+		}
+	}
+	return nil, false
+}
+
+func (t *Tree) Put(key string, value interface{}) {
+	t.root = t.put(t.root, key, value)
+}
+
+func (t *Tree) Delete(key string) bool {
+	var ok bool
+	t.root, ok = t.delete(t.root, key)
+	if ok {
+		t.size--
+	}
+	return ok
+}
+
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// Iterate visits keys in ascending order
+func (t *Tree) Iterate(fn func(key string, value interface{}) bool) {
+	ascend(t.root, "", fn)
+}
+
+// Ascend visits keys greater than or equal to from in ascending order until fn returns false
+func (t *Tree) Ascend(from string, fn func(key string, value interface{}) bool) {
+	ascend(t.root, from, fn)
+}
+
+func (t *Tree) Snapshot() Engine {
+	return &Tree{root: t.root, size: t.size}
+}
+
+func (t *Tree) put(n *node, key string, value interface{}) *node {
+	if n == nil {
+		t.size++
+		return &node{key: key, value: value, height: 1}
+	}
+	n = n.copy()
+	switch {
+	case key < n.key:
+		n.left = t.put(n.left, key, value)
+	case key > n.key:
+		n.right = t.put(n.right, key, value)
+	default:
+		n.value = value
+		return n
+	}
+	return rebalance(n)
+}
+
+func (t *Tree) delete(n *node, key string) (*node, bool) {
+	if n == nil {
+		return nil, false
+	}
+	switch {
+	case key < n.key:
+		left, ok := t.delete(n.left, key)
+		if !ok {
+			return n, false
+		}
+		n = n.copy()
+		n.left = left
+	case key > n.key:
+		right, ok := t.delete(n.right, key)
+		if !ok {
+			return n, false
+		}
+		n = n.copy()
+		n.right = right
+	default:
+		if n.left == nil {
+			return n.right, true
+		}
+		if n.right == nil {
+			return n.left, true
+		}
+		min := n.right
+		for min.left != nil {
+			min = min.left
+		}
+		n = n.copy()
+		n.key, n.value = min.key, min.value
+		n.right, _ = t.delete(n.right, min.key)
+	}
+	return rebalance(n), true
+}
+
+func ascend(n *node, from string, fn func(key string, value interface{}) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.key >= from {
+		if !ascend(n.left, from, fn) || !fn(n.key, n.value) {
+			return false
+		}
+	}
+	return ascend(n.right, from, fn)
+}
+
+func (n *node) copy() *node {
+	c := *n
+	return &c
+}
+
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func (n *node) fix() {
+	n.height = height(n.left) + 1
+	if r := height(n.right) + 1; r > n.height {
+		n.height = r
+	}
+}
+
+// rotateLeft and rotateRight copy the nodes they change, a child may still be shared with snapshots
+func rotateLeft(n *node) *node {
+	n, r := n.copy(), n.right.copy()
+	n.right, r.left = r.left, n
+	n.fix()
+	r.fix()
+	return r
+}
+
+func rotateRight(n *node) *node {
+	n, l := n.copy(), n.left.copy()
+	n.left, l.right = l.right, n
+	n.fix()
+	l.fix()
+	return l
+}
+
+func rebalance(n *node) *node {
+	n.fix()
+	switch b := height(n.left) - height(n.right); {
+	case b > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = rotateLeft(n.left)
+		}
+		return rotateRight(n)
+	case b < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = rotateRight(n.right)
+		}
+		return rotateLeft(n)
+	}
+	return n
+}
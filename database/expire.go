@@ -0,0 +1,146 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// NoExpiry is returned by TTL for keys which never expire
+const NoExpiry time.Duration = -1
+
+// reapInterval is how often the reaper removes expired keys
+const reapInterval = time.Second
+
+// Expire sets key to expire after ttl
+func (d *DB) Expire(key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %v", ttl)
+	}
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	defer d.lock(key).mu.Unlock()
+	if _, ok := d.lookup(key); !ok {
+		return fmt.Errorf("%s doesn't exist", key)
+	}
+
+	d.setExpiry(key, ttl)
+	d.changed(key)
+	return nil
+}
+
+// TTL returns the time left until key expires or NoExpiry if it never does
+func (d *DB) TTL(key string) (time.Duration, error) {
+	defer d.rlock(key).mu.RUnlock()
+	if _, ok := d.lookup(key); !ok {
+		return 0, fmt.Errorf("%s doesn't exist", key)
+	}
+
+	exp, ok := d.expiry(key)
+	if !ok {
+		return NoExpiry, nil
+	}
+	return time.Until(exp), nil
+}
+
+// Persist removes the expiry from key
+func (d *DB) Persist(key string) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	s := d.lock(key)
+	defer s.mu.Unlock()
+	if _, ok := d.lookup(key); !ok {
+		return fmt.Errorf("%s doesn't exist", key)
+	}
+
+	if _, ok := d.expiry(key); !ok {
+		return nil
+	}
+	s.expires.Delete(key)
+	d.changed(key)
+	return nil
+}
+
+// setExpiry sets key to expire after ttl, or clears it's expiry if ttl is 0. Caller must lock key
+func (d *DB) setExpiry(key string, ttl time.Duration) {
+	s := d.shardOf(key)
+	if ttl == 0 {
+		s.expires.Delete(key)
+		return
+	}
+	s.expires.Put(key, time.Now().Add(ttl))
+}
+
+// expiry returns the time key expires at, false if it never does. Caller must lock key
+func (d *DB) expiry(key string) (time.Time, bool) {
+	exp, ok := d.shardOf(key).expires.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return exp.(time.Time), true
+}
+
+// expired reports whether key has an expiry in the past. Caller must lock key
+func (d *DB) expired(key string) bool {
+	exp, ok := d.expiry(key)
+	return ok && !time.Now().Before(exp)
+}
+
+// startReaper starts removing expired keys in the background
+func (d *DB) startReaper() {
+	defer d.lockAll()()
+	if d.reaperDone != nil {
+		return
+	}
+	done := make(chan struct{})
+	d.reaperDone = done
+
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.reap()
+			}
+		}
+	}()
+}
+
+// stopReaper stops the background reaper. Caller must lock all keys
+func (d *DB) stopReaper() {
+	if d.reaperDone == nil {
+		return
+	}
+	close(d.reaperDone)
+	d.reaperDone = nil
+}
+
+// reap removes all expired keys, locking one shard at a time
+func (d *DB) reap() {
+	for _, s := range d.shards {
+		d.reapShard(s)
+	}
+}
+
+// reapShard removes expired keys of shard s
+func (d *DB) reapShard(s *shard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := []string{}
+	now := time.Now()
+	// removing keys while iterating is safe, iteration continues over the unchanged trie
+	s.expires.Iterate(func(k string, exp interface{}) bool {
+		if !now.Before(exp.(time.Time)) {
+			d.remove(k)
+			removed = append(removed, k)
+		}
+		return true
+	})
+	if len(removed) > 0 {
+		d.changed(removed...)
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// errBadPattern is returned for glob patterns with unclosed classes or trailing escapes
+var errBadPattern = errors.New("syntax error in pattern")
+
+// globMeta are the characters with special meaning in a glob pattern
+const globMeta = `*?[\`
+
+// validGlob checks pattern syntax so matching never has to report errors
+func validGlob(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i++; i >= len(pattern) {
+				return errBadPattern
+			}
+		case '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				return errBadPattern
+			}
+			i = end
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether s matches pattern. Supported syntax is * (any sequence, including /), ? (any character),
+// [abc], [a-z] and [^a] or [!a] classes and \ escapes. Pattern must be valid, see validGlob
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			_, n := utf8.DecodeRuneInString(s)
+			s, pattern = s[n:], pattern[1:]
+		case '[':
+			if s == "" {
+				return false
+			}
+			end := classEnd(pattern, 0)
+			r, n := utf8.DecodeRuneInString(s)
+			if !matchClass(pattern[1:end], r) {
+				return false
+			}
+			s, pattern = s[n:], pattern[end+1:]
+		default:
+			if pattern[0] == '\\' {
+				pattern = pattern[1:]
+			}
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			s, pattern = s[1:], pattern[1:]
+		}
+	}
+	return s == ""
+}
+
+// globPrefix returns the literal part of pattern before the first meta character
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, globMeta); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// classEnd returns the index of the ] closing the class starting at pattern[start], or -1
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '^' || pattern[i] == '!') {
+		i++
+	}
+	// a ] right after the opening bracket is a literal
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// matchClass reports whether r is in class, the contents between [ and ]
+func matchClass(class string, r rune) bool {
+	negate := false
+	if class != "" && (class[0] == '^' || class[0] == '!') {
+		negate, class = true, class[1:]
+	}
+
+	matched := false
+	for class != "" {
+		lo, n := classRune(class)
+		class = class[n:]
+		hi := lo
+		if len(class) > 1 && class[0] == '-' {
+			hi, n = classRune(class[1:])
+			class = class[1+n:]
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	return matched != negate
+}
+
+func classRune(class string) (rune, int) {
+	if class[0] == '\\' && len(class) > 1 {
+		r, n := utf8.DecodeRuneInString(class[1:])
+		return r, n + 1
+	}
+	return utf8.DecodeRuneInString(class)
+}
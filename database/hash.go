@@ -0,0 +1,153 @@
+package database
+
+import "fmt"
+
+// Hash is the value of keys created by hash operations, a map of fields to values.
+// Like lists, hashes are never modified in place
+type Hash map[string]interface{}
+
+// HSet sets field of the hash at key to value, creating the hash if it doesn't exist.
+// It reports whether the field is new
+func (d *DB) HSet(key, field string, value interface{}) (bool, error) {
+	if err := d.makeRoom(); err != nil {
+		return false, err
+	}
+	defer d.lock(key).mu.Unlock()
+	h, err := d.hash(key)
+	if err != nil {
+		return false, err
+	}
+	if h == nil {
+		d.setExpiry(key, 0)
+	}
+	_, exists := h[field]
+	nh := h.copy(1)
+	nh[field] = value
+	d.storeHash(key, nh)
+	return !exists, nil
+}
+
+// HGet returns field of the hash at key
+func (d *DB) HGet(key, field string) (interface{}, error) {
+	defer d.rlock(key).mu.RUnlock()
+	h, err := d.hash(key)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := h[field]
+	if !ok {
+		return nil, fmt.Errorf("field %s of %s doesn't exist", field, key)
+	}
+	return v, nil
+}
+
+// HDel removes fields from the hash at key and returns how many of them existed. The key is deleted if no fields are left
+func (d *DB) HDel(key string, fields ...string) (int, error) {
+	if err := d.checkOpen(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	h, err := d.hash(key)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range fields {
+		if _, ok := h[f]; ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	nh := h.copy(0)
+	for _, f := range fields {
+		delete(nh, f)
+	}
+	d.storeHash(key, nh)
+	return n, nil
+}
+
+// HGetAll returns all fields of the hash at key, an empty map if it doesn't exist
+func (d *DB) HGetAll(key string) (map[string]interface{}, error) {
+	defer d.rlock(key).mu.RUnlock()
+	h, err := d.hash(key)
+	if err != nil {
+		return nil, err
+	}
+	return h.copy(0), nil
+}
+
+// HExists reports whether the hash at key has field
+func (d *DB) HExists(key, field string) (bool, error) {
+	defer d.rlock(key).mu.RUnlock()
+	h, err := d.hash(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := h[field]
+	return ok, nil
+}
+
+// HIncrBy adds delta to the integer in field of the hash at key and returns the result.
+// A missing field counts as 0
+func (d *DB) HIncrBy(key, field string, delta int64) (int64, error) {
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	h, err := d.hash(key)
+	if err != nil {
+		return 0, err
+	}
+	if h == nil {
+		d.setExpiry(key, 0)
+	}
+
+	var n int64
+	if v, ok := h[field]; ok {
+		if n, ok = toInt(v); !ok {
+			return 0, fmt.Errorf("field %s of %s: %w", field, key, ErrNotInteger)
+		}
+	}
+	res, ok := addInt(n, delta)
+	if !ok {
+		return 0, fmt.Errorf("increment would overflow field %s of %s", field, key)
+	}
+	nh := h.copy(1)
+	nh[field] = res
+	d.storeHash(key, nh)
+	return res, nil
+}
+
+// copy returns a copy of h with room for extra more fields
+func (h Hash) copy(extra int) Hash {
+	c := make(Hash, len(h)+extra)
+	for f, v := range h {
+		c[f] = v
+	}
+	return c
+}
+
+// hash returns the hash at key, nil if it doesn't exist. Caller must lock key
+func (d *DB) hash(key string) (Hash, error) {
+	v, ok := d.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	h, ok := v.(Hash)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return h, nil
+}
+
+// storeHash stores h under key, deleting the key if h is empty. Caller must lock key
+func (d *DB) storeHash(key string, h Hash) {
+	if len(h) == 0 {
+		d.remove(key)
+	} else {
+		d.put(key, h)
+	}
+	d.changed(key)
+}
@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces f with data without ever leaving a partially written file behind.
+// Data is written to a temporary file which is synced and renamed over f. If backups is above 0
+// the previous contents of f are kept as f.1, f.2... up to f.{backups}, newest first
+func WriteFileAtomic(f string, data []byte, backups int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f), filepath.Base(f)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, FileMode); err != nil {
+		return err
+	}
+
+	if backups > 0 && FileExists(f) {
+		if err := rotate(f, backups); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpPath, f); err != nil {
+		return err
+	}
+	SyncDir(filepath.Dir(f))
+	return nil
+}
+
+// rotate shifts f.1 to f.2 and so on, dropping the oldest backup, and moves f to f.1
+func rotate(f string, backups int) error {
+	for i := backups - 1; i >= 1; i-- {
+		if !FileExists(BackupPath(f, i)) {
+			continue
+		}
+		if err := os.Rename(BackupPath(f, i), BackupPath(f, i+1)); err != nil {
+			return err
+		}
+	}
+	return os.Rename(f, BackupPath(f, 1))
+}
+
+// SyncDir flushes directory entries so a rename survives a crash. Not every platform supports it, so errors are ignored
+func SyncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
@@ -1,10 +1,63 @@
 package helpers
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"hash/crc32"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
+// FileMode is the permission database files are created with
+const FileMode os.FileMode = 0600
+
+// formatKey marks a file written in the snapshot format, files without it are read as a plain key/value map
+const formatKey = "go-store"
+
+// formatVersion is the current version of the snapshot format
+const formatVersion = 1
+
+// headerPrefix starts the checksum line written before the snapshot json
+const headerPrefix = "#go-store crc32c="
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Snapshot is the on-disk representation of a database
+type Snapshot struct {
+	Version int                    `json:"go-store"`
+	Data    map[string]interface{} `json:"data"`
+	Expires map[string]time.Time   `json:"expires,omitempty"`
+	// Versions of keys, so versions keep increasing after a restart
+	Versions map[string]uint64 `json:"versions,omitempty"`
+	// Types of keys holding native types like lists, keys without one hold plain values
+	Types map[string]string `json:"types,omitempty"`
+	// Indexes are definitions of secondary indexes by name, their entries are rebuilt when loading
+	Indexes map[string]IndexDef `json:"indexes,omitempty"`
+	// Segments is the number of segments keys are split into, set only in segment files
+	Segments int `json:"segments,omitempty"`
+}
+
+// IndexDef defines a secondary index over a field of values whose keys start with Prefix
+type IndexDef struct {
+	Prefix string `json:"prefix"`
+	// Path selects the field, as a JSON Pointer or a dot separated path
+	Path string `json:"path"`
+}
+
+// NewSnapshot returns a snapshot of the current format version
+func NewSnapshot(data map[string]interface{}, expires map[string]time.Time, versions map[string]uint64, types map[string]string) *Snapshot {
+	return &Snapshot{
+		Version:  formatVersion,
+		Data:     data,
+		Expires:  expires,
+		Versions: versions,
+		Types:    types,
+	}
+}
+
 func FileExists(f string) bool {
 	_, err := os.Stat(f)
 	return err == nil
@@ -25,13 +78,102 @@ func FileExists(f string) bool {
 
 // }
 
-func ReadJsonToMap(f string) (map[string]interface{}, error) {
+// ReadSnapshot reads a database file. Plain key/value maps written by older versions are also accepted
+func ReadSnapshot(f string) (*Snapshot, error) {
 	bytes, err := os.ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
-	data := make(map[string]interface{}, 10)
-	_ = json.Unmarshal(bytes, &data)
+	return DecodeSnapshot(bytes)
+}
+
+// ReadLatestSnapshot reads the database file at f, falling back to rotated backups f.1, f.2... if it's missing or corrupt.
+// It returns the snapshot along with the path it was read from
+func ReadLatestSnapshot(f string) (*Snapshot, string, error) {
+	snap, err := ReadSnapshot(f)
+	if err == nil {
+		return snap, f, nil
+	}
+
+	for i := 1; ; i++ {
+		backup := BackupPath(f, i)
+		if !FileExists(backup) {
+			return nil, f, err
+		}
+		if snap, berr := ReadSnapshot(backup); berr == nil {
+			return snap, backup, nil
+		}
+	}
+}
 
-	return data, nil
+// BackupPath returns the path of the n-th rotated backup of f
+func BackupPath(f string, n int) string {
+	return f + "." + strconv.Itoa(n)
+}
+
+// SegmentDir returns the directory holding segment files of the database at f
+func SegmentDir(f string) string {
+	return f + ".segments"
+}
+
+// OldSegmentDir returns the directory segments in dir are moved to while they're being replaced
+func OldSegmentDir(dir string) string {
+	return dir + ".old"
+}
+
+// SegmentPath returns the path of the n-th segment file in dir
+func SegmentPath(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("%03d.json", n))
+}
+
+// EncodeSnapshot encodes snap as json preceded by a checksum header
+func EncodeSnapshot(snap *Snapshot) ([]byte, error) {
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("%s%08x\n", headerPrefix, crc32.Checksum(body, crcTable))
+	return append([]byte(header), body...), nil
+}
+
+// DecodeSnapshot decodes the contents of a database file, verifying the checksum if it has one
+func DecodeSnapshot(b []byte) (*Snapshot, error) {
+	if bytes.HasPrefix(b, []byte(headerPrefix)) {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			return nil, fmt.Errorf("truncated header")
+		}
+		sum, err := strconv.ParseUint(string(b[len(headerPrefix):nl]), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checksum header: %v", err)
+		}
+		b = b[nl+1:]
+		if crc32.Checksum(b, crcTable) != uint32(sum) {
+			return nil, fmt.Errorf("checksum mismatch")
+		}
+	}
+
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	_, versioned := raw[formatKey]
+	_, hasData := raw["data"]
+	if !versioned || !hasData {
+		data := make(map[string]interface{}, len(raw))
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, err
+		}
+		return NewSnapshot(data, nil, nil, nil), nil
+	}
+
+	snap := &Snapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		return nil, err
+	}
+	if snap.Data == nil {
+		snap.Data = make(map[string]interface{})
+	}
+	return snap, nil
 }
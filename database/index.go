@@ -0,0 +1,270 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/maracko/go-store/database/document"
+	"github.com/maracko/go-store/database/engine"
+	"github.com/maracko/go-store/database/helpers"
+	"github.com/maracko/go-store/database/write"
+)
+
+// ErrNotIndexable is returned when looking up a value which can't be stored in an index
+var ErrNotIndexable = errors.New("only strings, numbers and booleans can be looked up in an index")
+
+// Index describes a secondary index over the field at Path of values whose keys start with Prefix
+type Index struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Path   string `json:"path"`
+}
+
+// secondaryIndex maps encoded field values followed by the key to the key, so keys with equal fields
+// are kept next to each other and ordered by the field
+type secondaryIndex struct {
+	def     helpers.IndexDef
+	path    document.Pointer
+	entries *engine.Tree
+}
+
+// entry returns the index entry of key holding value, false if key is not indexed
+func (x *secondaryIndex) entry(key string, value interface{}) (string, bool) {
+	if !strings.HasPrefix(key, x.def.Prefix) {
+		return "", false
+	}
+	doc, err := documentOf(value)
+	if err != nil {
+		return "", false
+	}
+	field, err := x.path.Get(doc)
+	if err != nil {
+		return "", false
+	}
+	enc, ok := encodeIndexValue(field)
+	if !ok {
+		return "", false
+	}
+	return enc + key, true
+}
+
+// encodeIndexValue encodes v so that encoded values sort like the values themselves.
+// Booleans sort before numbers and numbers before strings, other values can't be indexed
+func encodeIndexValue(v interface{}) (string, bool) {
+	var f float64
+	switch n := v.(type) {
+	case bool:
+		if n {
+			return "b1", true
+		}
+		return "b0", true
+	case string:
+		// strings are terminated so a string is never a prefix of the entries of a longer one
+		return "s" + strings.Replace(n, "\x00", "\x00\x01", -1) + "\x00\x00", true
+	case float64:
+		f = n
+	case float32:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case int:
+		f = float64(n)
+	default:
+		return "", false
+	}
+	if math.IsNaN(f) {
+		return "", false
+	}
+	if f == 0 {
+		f = 0 // -0 equals 0
+	}
+	bits := math.Float64bits(f)
+	if f < 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return fmt.Sprintf("n%016x", bits), true
+}
+
+// CreateIndex creates an index called name over the field at path of values whose keys start with prefix,
+// and indexes all existing keys. Path is a JSON Pointer or a dot separated path, empty path indexes whole values
+func (d *DB) CreateIndex(name, prefix, path string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid index name %q, use up to 64 letters, digits, _ or -", name)
+	}
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	defer d.lockAll()()
+	if _, ok := d.indexes[name]; ok {
+		return fmt.Errorf("index %s already exists", name)
+	}
+	def := helpers.IndexDef{Prefix: prefix, Path: path}
+	if err := d.createIndex(name, def); err != nil {
+		return err
+	}
+	d.indexChanged(write.NewIndexRecord(name, def))
+	return nil
+}
+
+// DropIndex deletes the index called name
+func (d *DB) DropIndex(name string) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	defer d.lockAll()()
+	if _, ok := d.indexes[name]; !ok {
+		return fmt.Errorf("index %s doesn't exist", name)
+	}
+	delete(d.indexes, name)
+	d.indexChanged(write.NewDropIndexRecord(name))
+	return nil
+}
+
+// Indexes returns all indexes ordered by name
+func (d *DB) Indexes() []Index {
+	defer d.rlockAll()()
+	res := make([]Index, 0, len(d.indexes))
+	for name, x := range d.indexes {
+		res = append(res, Index{name, x.def.Prefix, x.def.Path})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Find returns entries whose indexed field equals value, ordered by key. Limit of 0 returns all of them
+func (d *DB) Find(name string, value interface{}, limit int) ([]Entry, error) {
+	enc, ok := encodeIndexValue(value)
+	if !ok {
+		return nil, ErrNotIndexable
+	}
+	return d.findRange(name, enc, enc, limit)
+}
+
+// FindRange returns entries whose indexed field is in range [min, max], ordered by the field and then by key.
+// Nil min or max leaves that side of the range open, limit of 0 returns all of them
+func (d *DB) FindRange(name string, min, max interface{}, limit int) ([]Entry, error) {
+	var from, to string
+	var ok bool
+	if min != nil {
+		if from, ok = encodeIndexValue(min); !ok {
+			return nil, ErrNotIndexable
+		}
+	}
+	if max != nil {
+		if to, ok = encodeIndexValue(max); !ok {
+			return nil, ErrNotIndexable
+		}
+	}
+	return d.findRange(name, from, to, limit)
+}
+
+// findRange returns entries of index name from encoded value from up to and including encoded value to.
+// Empty to leaves the range open
+func (d *DB) findRange(name, from, to string, limit int) ([]Entry, error) {
+	defer d.rlockAll()()
+	x, ok := d.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("index %s doesn't exist", name)
+	}
+
+	res := []Entry{}
+	x.entries.Ascend(from, func(e string, k interface{}) bool {
+		if to != "" && e > to && !strings.HasPrefix(e, to) {
+			return false
+		}
+		if v, ok := d.lookup(k.(string)); ok {
+			res = append(res, Entry{k.(string), v})
+		}
+		return limit <= 0 || len(res) < limit
+	})
+	return res, nil
+}
+
+// createIndex adds an index and fills it with existing keys. Caller must lock all keys
+func (d *DB) createIndex(name string, def helpers.IndexDef) error {
+	path, err := document.ParsePath(def.Path)
+	if err != nil {
+		return err
+	}
+	x := &secondaryIndex{def: def, path: path, entries: engine.NewTree()}
+	d.ascend(def.Prefix, func(k string, v interface{}) bool {
+		if !strings.HasPrefix(k, def.Prefix) {
+			return false
+		}
+		if e, ok := x.entry(k, v); ok {
+			x.entries.Put(e, k)
+		}
+		return true
+	})
+	d.indexes[name] = x
+	return nil
+}
+
+// reindex replaces the index entries of key holding old with ones for value, nil old or value means the key
+// didn't or doesn't exist. Caller must lock key and hold d.indexMu
+func (d *DB) reindex(key string, old, value interface{}) {
+	for _, x := range d.indexes {
+		if old != nil {
+			if e, ok := x.entry(key, old); ok {
+				x.entries.Delete(e)
+			}
+		}
+		if value != nil {
+			if e, ok := x.entry(key, value); ok {
+				x.entries.Put(e, key)
+			}
+		}
+	}
+}
+
+// indexChanged persists a change of index definitions. Caller must lock all keys
+func (d *DB) indexChanged(rec *write.Record) {
+	if d.memory || d.location == "" {
+		return
+	}
+	if d.appendOnly {
+		if err := d.writeService.Append(rec); err != nil {
+			go func() { d.errChan <- err }()
+		}
+		return
+	}
+	d.indexesChanged = true
+	if d.continousWrite {
+		go d.NewWrite()
+	}
+}
+
+// indexDefs returns definitions of all indexes. Caller must lock all keys
+func (d *DB) indexDefs() map[string]helpers.IndexDef {
+	defs := make(map[string]helpers.IndexDef, len(d.indexes))
+	for name, x := range d.indexes {
+		defs[name] = x.def
+	}
+	return defs
+}
+
+// indexRecords returns log records defining all indexes. Caller must lock all keys
+func (d *DB) indexRecords() []*write.Record {
+	recs := make([]*write.Record, 0, len(d.indexes))
+	for name, x := range d.indexes {
+		recs = append(recs, write.NewIndexRecord(name, x.def))
+	}
+	return recs
+}
+
+// applyIndex restores an index definition from a replayed log record
+func (d *DB) applyIndex(r *write.Record) {
+	m, _ := r.Value.(map[string]interface{})
+	prefix, _ := m["prefix"].(string)
+	path, _ := m["path"].(string)
+	delete(d.indexes, r.Key)
+	if err := d.createIndex(r.Key, helpers.IndexDef{Prefix: prefix, Path: path}); err != nil {
+		log.Printf("Skipping index %s: %v", r.Key, err)
+	}
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// List is the value of keys created by list operations.
+// Lists are never modified in place, every operation stores a new one so values handed out stay unchanged
+type List []interface{}
+
+// ErrPopTimeout is returned by blocking pops when no element arrives in time
+var ErrPopTimeout = errors.New("timed out waiting for an element")
+
+// LPush prepends values to the list at key, creating it if it doesn't exist, and returns it's new length.
+// Values are pushed one after another, so the last one ends up first
+func (d *DB) LPush(key string, values ...interface{}) (int, error) {
+	return d.push(key, true, values)
+}
+
+// RPush appends values to the list at key, creating it if it doesn't exist, and returns it's new length
+func (d *DB) RPush(key string, values ...interface{}) (int, error) {
+	return d.push(key, false, values)
+}
+
+// LPop removes and returns the first element of the list at key
+func (d *DB) LPop(key string) (interface{}, error) {
+	defer d.lock(key).mu.Unlock()
+	return d.pop(key, true)
+}
+
+// RPop removes and returns the last element of the list at key
+func (d *DB) RPop(key string) (interface{}, error) {
+	defer d.lock(key).mu.Unlock()
+	return d.pop(key, false)
+}
+
+// BLPop is LPop which waits for an element to be pushed if the list is empty.
+// It gives up with ErrPopTimeout after timeout, a timeout of 0 waits until ctx is done
+func (d *DB) BLPop(ctx context.Context, key string, timeout time.Duration) (interface{}, error) {
+	return d.blockingPop(ctx, key, true, timeout)
+}
+
+// BRPop is RPop which waits for an element to be pushed if the list is empty.
+// It gives up with ErrPopTimeout after timeout, a timeout of 0 waits until ctx is done
+func (d *DB) BRPop(ctx context.Context, key string, timeout time.Duration) (interface{}, error) {
+	return d.blockingPop(ctx, key, false, timeout)
+}
+
+// LRange returns elements of the list at key from start to stop, both inclusive.
+// Negative indexes count from the end, -1 being the last element. A missing key is an empty list
+func (d *DB) LRange(key string, start, stop int) ([]interface{}, error) {
+	defer d.rlock(key).mu.RUnlock()
+	l, err := d.list(key)
+	if err != nil {
+		return nil, err
+	}
+	start, stop = listRange(len(l), start, stop)
+	res := make([]interface{}, stop-start)
+	copy(res, l[start:stop])
+	return res, nil
+}
+
+// LLen returns the length of the list at key, 0 if it doesn't exist
+func (d *DB) LLen(key string) (int, error) {
+	defer d.rlock(key).mu.RUnlock()
+	l, err := d.list(key)
+	return len(l), err
+}
+
+// LTrim keeps only elements from start to stop of the list at key, indexed like in LRange, and returns it's new length.
+// The key is deleted if nothing is left
+func (d *DB) LTrim(key string, start, stop int) (int, error) {
+	if err := d.checkOpen(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	l, err := d.list(key)
+	if err != nil || len(l) == 0 {
+		return 0, err
+	}
+	start, stop = listRange(len(l), start, stop)
+	if start == 0 && stop == len(l) {
+		return len(l), nil
+	}
+	d.storeList(key, l[start:stop:stop])
+	return stop - start, nil
+}
+
+func (d *DB) push(key string, left bool, values []interface{}) (int, error) {
+	if len(values) == 0 {
+		return 0, errors.New("nothing to push")
+	}
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	s := d.lock(key)
+	defer s.mu.Unlock()
+	l, err := d.list(key)
+	if err != nil {
+		return 0, err
+	}
+	if l == nil {
+		// the key may still have the expiry of an expired value
+		d.setExpiry(key, 0)
+	}
+
+	var nl List
+	if left {
+		nl = make(List, 0, len(l)+len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			nl = append(nl, values[i])
+		}
+		nl = append(nl, l...)
+	} else {
+		// l is capped so appending copies it, other values may share it's backing array
+		nl = append(l[:len(l):len(l)], values...)
+	}
+	d.storeList(key, nl)
+
+	if ch, ok := s.pushed[key]; ok {
+		close(ch)
+		delete(s.pushed, key)
+	}
+	return len(nl), nil
+}
+
+// pop removes an element from either end of the list at key. Caller must lock key
+func (d *DB) pop(key string, left bool) (interface{}, error) {
+	if err := d.checkOpen(); err != nil {
+		return nil, err
+	}
+	l, err := d.list(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(l) == 0 {
+		return nil, fmt.Errorf("%s doesn't exist", key)
+	}
+	var v interface{}
+	if left {
+		v, l = l[0], l[1:]
+	} else {
+		// capped so a later push can't overwrite v in lists handed out before
+		v, l = l[len(l)-1], l[:len(l)-1:len(l)-1]
+	}
+	d.storeList(key, l)
+	return v, nil
+}
+
+func (d *DB) blockingPop(ctx context.Context, key string, left bool, timeout time.Duration) (interface{}, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout %v", timeout)
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	for {
+		s := d.lock(key)
+		v, err := d.pop(key, left)
+		if err == nil || err == ErrWrongType || err == ErrClosed {
+			s.mu.Unlock()
+			return v, err
+		}
+		ch, ok := s.pushed[key]
+		if !ok {
+			ch = make(chan struct{})
+			s.pushed[key] = ch
+		}
+		s.mu.Unlock()
+
+		// every waiter wakes up on a push, those which lose the race for the element wait again
+		select {
+		case <-ch:
+		case <-expired:
+			return nil, ErrPopTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// list returns the list at key, nil if it doesn't exist. Caller must lock key
+func (d *DB) list(key string) (List, error) {
+	v, ok := d.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	l, ok := v.(List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return l, nil
+}
+
+// storeList stores l under key, deleting the key if l is empty. Caller must lock key
+func (d *DB) storeList(key string, l List) {
+	if len(l) == 0 {
+		d.remove(key)
+	} else {
+		d.put(key, l)
+	}
+	d.changed(key)
+}
+
+// listRange converts start and stop, which may count from the end, to slice bounds of a list of length n
+func listRange(n, start, stop int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	stop++
+	if stop > n {
+		stop = n
+	}
+	if start >= stop {
+		return 0, 0
+	}
+	return start, stop
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOutOfMemory is returned by writes while the database is over it's memory limit and nothing can be evicted
+var ErrOutOfMemory = errors.New("database is over it's memory limit")
+
+// EvictionPolicy decides which keys are evicted once the database is over it's memory limit
+type EvictionPolicy string
+
+const (
+	// NoEviction rejects writes with ErrOutOfMemory instead of evicting keys
+	NoEviction EvictionPolicy = "noeviction"
+	// AllKeysLRU evicts the least recently used keys
+	AllKeysLRU EvictionPolicy = "allkeys-lru"
+	// AllKeysLFU evicts the least frequently used keys
+	AllKeysLFU EvictionPolicy = "allkeys-lfu"
+	// AllKeysRandom evicts random keys
+	AllKeysRandom EvictionPolicy = "allkeys-random"
+	// VolatileLRU evicts the least recently used keys which have an expiry
+	VolatileLRU EvictionPolicy = "volatile-lru"
+	// VolatileLFU evicts the least frequently used keys which have an expiry
+	VolatileLFU EvictionPolicy = "volatile-lfu"
+	// VolatileRandom evicts random keys which have an expiry
+	VolatileRandom EvictionPolicy = "volatile-random"
+	// VolatileTTL evicts keys closest to expiring
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+)
+
+var evictionPolicies = []EvictionPolicy{NoEviction, AllKeysLRU, AllKeysLFU, AllKeysRandom, VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL}
+
+// ParseEvictionPolicy validates policy name p
+func ParseEvictionPolicy(p string) (EvictionPolicy, error) {
+	names := make([]string, len(evictionPolicies))
+	for i, policy := range evictionPolicies {
+		if EvictionPolicy(p) == policy {
+			return policy, nil
+		}
+		names[i] = string(policy)
+	}
+	return "", fmt.Errorf("unknown eviction policy %q, must be one of %s", p, strings.Join(names, ", "))
+}
+
+// evictionSamples is how many keys are compared to pick one to evict, like Redis eviction is approximate
+const evictionSamples = 5
+
+// lfuDecay is how many accesses of the database halve the use count of a key which isn't accessed in between
+const lfuDecay = 10000
+
+// WithMaxMemory limits the approximate size of keys and values to maxMemory bytes, evicting keys by policy
+// before writes once it's exceeded
+func WithMaxMemory(maxMemory int64, policy EvictionPolicy) Option {
+	return func(d *DB) {
+		d.maxMemory = maxMemory
+		d.policy = policy
+	}
+}
+
+// MemoryStats describes memory use and evictions, sizes are approximate and in bytes
+type MemoryStats struct {
+	MaxMemory  int64          `json:"maxMemory"`
+	UsedMemory int64          `json:"usedMemory"`
+	Policy     EvictionPolicy `json:"policy"`
+	Keys       int            `json:"keys"`
+	// Evicted is the number of keys evicted since the database was opened
+	Evicted uint64 `json:"evicted"`
+	// Rejected is the number of writes rejected with ErrOutOfMemory
+	Rejected uint64 `json:"rejected"`
+}
+
+// usage tracks accesses of a key for LRU and LFU eviction
+type usage struct {
+	// last is the value of the access clock at the last access
+	last uint64
+	hits uint64
+}
+
+// MemoryStats returns memory use and eviction counters. Memory is only accounted while there's a limit
+func (d *DB) MemoryStats() MemoryStats {
+	defer d.rlockAll()()
+	return MemoryStats{
+		MaxMemory:  d.maxMemory,
+		UsedMemory: atomic.LoadInt64(&d.used),
+		Policy:     d.policy,
+		Keys:       d.len(),
+		Evicted:    atomic.LoadUint64(&d.evicted),
+		Rejected:   atomic.LoadUint64(&d.rejected),
+	}
+}
+
+// makeRoom evicts keys until the database is within it's memory limit. It's called by writes before they lock
+// their keys, since evicting locks all of them, and fails with ErrClosed once the database is disconnected
+func (d *DB) makeRoom() error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	if d.maxMemory <= 0 || atomic.LoadInt64(&d.used) <= d.maxMemory {
+		return nil
+	}
+	defer d.lockAll()()
+	return d.evict()
+}
+
+// evict is makeRoom for callers which already locked all keys
+func (d *DB) evict() error {
+	if d.maxMemory <= 0 || atomic.LoadInt64(&d.used) <= d.maxMemory {
+		return nil
+	}
+	evicted := []string{}
+	for atomic.LoadInt64(&d.used) > d.maxMemory {
+		k, ok := d.victim()
+		if !ok {
+			break
+		}
+		d.remove(k)
+		atomic.AddUint64(&d.evicted, 1)
+		evicted = append(evicted, k)
+	}
+	if len(evicted) > 0 {
+		d.changed(evicted...)
+	}
+	if atomic.LoadInt64(&d.used) > d.maxMemory {
+		atomic.AddUint64(&d.rejected, 1)
+		return ErrOutOfMemory
+	}
+	return nil
+}
+
+// victim picks the key to evict by comparing a few sampled keys, expired keys are picked first.
+// Caller must lock all keys
+func (d *DB) victim() (string, bool) {
+	var best string
+	var bestRank float64
+	found := false
+	consider := func(k string) bool {
+		if d.expired(k) {
+			best, found = k, true
+			return false
+		}
+		rank := d.evictionRank(k)
+		if !found || rank < bestRank {
+			best, bestRank, found = k, rank, true
+		}
+		return true
+	}
+
+	// keys are sampled from consecutive shards starting at a random one, map iteration starts at a random
+	// position as well, which is good enough for sampling
+	n := 0
+	start := rand.Intn(len(d.shards))
+	for i := 0; i < len(d.shards) && n < evictionSamples; i++ {
+		s := d.shards[(start+i)%len(d.shards)]
+		switch d.policy {
+		case AllKeysLRU, AllKeysLFU, AllKeysRandom:
+			for k := range s.sizes {
+				if n++; !consider(k) {
+					return best, found
+				}
+				break
+			}
+		case VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL:
+			if k, _, ok := s.expires.Random(rand.Intn); ok {
+				if n++; !consider(k) {
+					return best, found
+				}
+			}
+		}
+	}
+	return best, found
+}
+
+// evictionRank ranks key by the eviction policy, the key with the lowest rank is evicted first. Caller must lock all keys
+func (d *DB) evictionRank(key string) float64 {
+	usage := d.shardOf(key).usage
+	switch d.policy {
+	case AllKeysLRU, VolatileLRU:
+		if u := usage[key]; u != nil {
+			return float64(u.last)
+		}
+		return 0
+	case AllKeysLFU, VolatileLFU:
+		return float64(d.hits(usage[key]))
+	case VolatileTTL:
+		exp, _ := d.expiry(key)
+		return float64(time.Until(exp))
+	}
+	return 0
+}
+
+// hits returns the use count of u, halved for every lfuDecay accesses of the database since u was last accessed.
+// Caller must lock the key of u
+func (d *DB) hits(u *usage) uint64 {
+	if u == nil {
+		return 0
+	}
+	halvings := (atomic.LoadUint64(&d.clock) - u.last) / lfuDecay
+	if halvings >= 64 {
+		return 0
+	}
+	return u.hits >> halvings
+}
+
+// touch records an access of key. Reads call it too, so caller must lock key at least for reading
+func (d *DB) touch(key string) {
+	switch d.policy {
+	case AllKeysLRU, AllKeysLFU, VolatileLRU, VolatileLFU:
+	default:
+		return
+	}
+	if d.maxMemory <= 0 {
+		return
+	}
+	s := d.shardOf(key)
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	u, ok := s.usage[key]
+	if !ok {
+		u = &usage{}
+		s.usage[key] = u
+	}
+	u.hits = d.hits(u) + 1
+	u.last = atomic.AddUint64(&d.clock, 1)
+}
+
+// account updates memory use after key was set to value or removed. Caller must lock key
+func (d *DB) account(key string, value interface{}, removed bool) {
+	if d.maxMemory <= 0 {
+		return
+	}
+	s := d.shardOf(key)
+	atomic.AddInt64(&d.used, -s.sizes[key])
+	if removed {
+		delete(s.sizes, key)
+		s.usageMu.Lock()
+		delete(s.usage, key)
+		s.usageMu.Unlock()
+		return
+	}
+	size := entryOverhead + int64(len(key)) + sizeOf(value)
+	s.sizes[key] = size
+	atomic.AddInt64(&d.used, size)
+}
+
+// entryOverhead is the approximate memory used for every key besides the key and value, like it's version and map entry
+const entryOverhead = 64
+
+// sizeOf approximates the memory used by v in bytes
+func sizeOf(v interface{}) int64 {
+	switch c := v.(type) {
+	case string:
+		return 16 + int64(len(c))
+	case map[string]interface{}:
+		size := int64(48)
+		for k, v := range c {
+			size += 16 + int64(len(k)) + sizeOf(v)
+		}
+		return size
+	case Hash:
+		return sizeOf(map[string]interface{}(c))
+	case []interface{}:
+		size := int64(24)
+		for _, v := range c {
+			size += sizeOf(v)
+		}
+		return size
+	case List:
+		return sizeOf([]interface{}(c))
+	case Set:
+		size := int64(48)
+		for m := range c {
+			size += 16 + int64(len(m))
+		}
+		return size
+	case ZSet:
+		// every member has a node in both trees
+		size := int64(32)
+		zascendRank(c.byScore, 0, func(n *znode) bool {
+			size += 2 * (64 + int64(len(n.member)))
+			return true
+		})
+		return size
+	}
+	return 16
+}
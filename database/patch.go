@@ -0,0 +1,45 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/maracko/go-store/database/document"
+)
+
+// JSONPatch atomically applies JSON Patch operations to the value at key and returns the result.
+// If any of them fails, including a test, the value is left unchanged
+func (d *DB) JSONPatch(key string, ops []document.Operation) (interface{}, error) {
+	return d.patch(key, func(v interface{}) (interface{}, error) {
+		return document.Patch(v, ops)
+	})
+}
+
+// MergePatch atomically applies a JSON Merge Patch to the value at key and returns the result
+func (d *DB) MergePatch(key string, patch interface{}) (interface{}, error) {
+	return d.patch(key, func(v interface{}) (interface{}, error) {
+		return document.MergePatch(v, patch), nil
+	})
+}
+
+// patch replaces the value at key with the result of fn, which must not modify the value it's given
+func (d *DB) patch(key string, fn func(v interface{}) (interface{}, error)) (interface{}, error) {
+	if err := d.makeRoom(); err != nil {
+		return nil, err
+	}
+	defer d.lock(key).mu.Unlock()
+	v, ok := d.lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't exist", key)
+	}
+	if typeOf(v) != "" {
+		return nil, ErrWrongType
+	}
+
+	nv, err := fn(v)
+	if err != nil {
+		return nil, err
+	}
+	d.put(key, nv)
+	d.changed(key)
+	return nv, nil
+}
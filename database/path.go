@@ -0,0 +1,35 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/maracko/go-store/database/document"
+)
+
+// ReadPath returns the part of the value at key which path points to. Hashes and lists can be read into as well
+func (d *DB) ReadPath(key string, path document.Pointer) (interface{}, error) {
+	defer d.rlock(key).mu.RUnlock()
+	v, ok := d.lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't exist", key)
+	}
+
+	doc, err := documentOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return path.Get(doc)
+}
+
+// documentOf returns v as a plain JSON document, converting hashes and lists
+func documentOf(v interface{}) (interface{}, error) {
+	switch c := v.(type) {
+	case Hash:
+		return map[string]interface{}(c), nil
+	case List:
+		return []interface{}(c), nil
+	case Set, ZSet:
+		return nil, ErrWrongType
+	}
+	return v, nil
+}
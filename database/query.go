@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maracko/go-store/database/query"
+)
+
+// DefaultQueryLimit is the number of results of a query page if the query doesn't set a limit
+const DefaultQueryLimit = 100
+
+// MaxQueryLimit is the largest number of results a query page can have
+const MaxQueryLimit = 1000
+
+// QueryScanLimit is the most keys a query page examines, so a query matching few keys doesn't lock the database for too long.
+// Pages can have fewer results than the limit before the query is complete
+const QueryScanLimit = 10000
+
+// Query returns the next page of entries matching q in key order, with their values reduced to the selected fields.
+// The returned cursor continues the query and is CursorStart once it's complete, see ScanCursor
+func (d *DB) Query(q *query.Query) ([]Entry, string, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := validGlob(q.From); err != nil {
+		return nil, "", err
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit < 0 || limit > MaxQueryLimit {
+		return nil, "", fmt.Errorf("limit must be between 1 and %d", MaxQueryLimit)
+	}
+
+	prefix := globPrefix(q.From)
+	from := after
+	if prefix > from {
+		from = prefix
+	}
+
+	defer d.rlockAll()()
+
+	res := []Entry{}
+	examined := 0
+	last := ""
+	done := true
+	d.ascend(from, func(k string, v interface{}) bool {
+		if k == after && q.Cursor != "" && q.Cursor != CursorStart {
+			return true
+		}
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if len(res) == limit || examined == QueryScanLimit {
+			done = false
+			return false
+		}
+		examined++
+		last = k
+		if (q.From != "" && !matchGlob(q.From, k)) || d.expired(k) {
+			return true
+		}
+		// sets and sorted sets have no fields, so they are only matched by key
+		doc, err := documentOf(v)
+		if err != nil {
+			doc = nil
+		}
+		if q.Match(k, doc) {
+			if len(q.Select) > 0 {
+				v = q.Project(k, doc)
+			}
+			res = append(res, Entry{k, v})
+		}
+		return true
+	})
+
+	if done {
+		return res, CursorStart, nil
+	}
+	return res, encodeCursor(last), nil
+}
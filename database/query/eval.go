@@ -0,0 +1,140 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/maracko/go-store/database/document"
+)
+
+// Expr is a parsed expression, evaluated against a single key and it's value
+type Expr interface {
+	eval(key string, doc interface{}) interface{}
+}
+
+// Match reports whether the value doc stored at key matches the where clause of q
+func (q *Query) Match(key string, doc interface{}) bool {
+	return q.Where == nil || truthy(q.Where.eval(key, doc))
+}
+
+// Project returns the selected fields of doc by their names, or doc itself if nothing is selected.
+// Missing fields are left out
+func (q *Query) Project(key string, doc interface{}) interface{} {
+	if len(q.Select) == 0 {
+		return doc
+	}
+	res := make(map[string]interface{}, len(q.Select))
+	for _, f := range q.Select {
+		if v := f.expr.eval(key, doc); v != nil {
+			res[f.Name] = v
+		}
+	}
+	return res
+}
+
+type literal struct{ v interface{} }
+
+func (l literal) eval(string, interface{}) interface{} { return l.v }
+
+// field is the value at a path, missing fields evaluate to null
+type field document.Pointer
+
+func (f field) eval(_ string, doc interface{}) interface{} {
+	v, err := document.Pointer(f).Get(doc)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+type key struct{}
+
+func (key) eval(k string, _ interface{}) interface{} { return k }
+
+type and struct{ l, r Expr }
+
+func (e and) eval(k string, doc interface{}) interface{} {
+	return truthy(e.l.eval(k, doc)) && truthy(e.r.eval(k, doc))
+}
+
+type or struct{ l, r Expr }
+
+func (e or) eval(k string, doc interface{}) interface{} {
+	return truthy(e.l.eval(k, doc)) || truthy(e.r.eval(k, doc))
+}
+
+type not struct{ e Expr }
+
+func (e not) eval(k string, doc interface{}) interface{} {
+	return !truthy(e.e.eval(k, doc))
+}
+
+type compare struct {
+	op   string
+	l, r Expr
+}
+
+// comparisons implement comparison operators, contains and in
+var comparisons = map[string]func(a, b interface{}) bool{
+	"==":       document.Equal,
+	"!=":       func(a, b interface{}) bool { return !document.Equal(a, b) },
+	"<":        func(a, b interface{}) bool { c, ok := order(a, b); return ok && c < 0 },
+	"<=":       func(a, b interface{}) bool { c, ok := order(a, b); return ok && c <= 0 },
+	">":        func(a, b interface{}) bool { c, ok := order(a, b); return ok && c > 0 },
+	">=":       func(a, b interface{}) bool { c, ok := order(a, b); return ok && c >= 0 },
+	"contains": contains,
+	"in":       func(a, b interface{}) bool { return contains(b, a) },
+}
+
+func (e compare) eval(k string, doc interface{}) interface{} {
+	return comparisons[e.op](e.l.eval(k, doc), e.r.eval(k, doc))
+}
+
+// truthy reports whether v counts as true in a where clause, only true does
+func truthy(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// order compares two numbers or two strings, other values can't be ordered
+func order(a, b interface{}) (int, bool) {
+	if x, ok := document.Number(a); ok {
+		y, ok := document.Number(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, ok := a.(string)
+	y, ok2 := b.(string)
+	if !ok || !ok2 {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+// contains reports whether string a contains string b, array a has an element equal to b or object a has a member b
+func contains(a, b interface{}) bool {
+	switch c := a.(type) {
+	case string:
+		s, ok := b.(string)
+		return ok && strings.Contains(c, s)
+	case []interface{}:
+		for _, v := range c {
+			if document.Equal(v, b) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		s, ok := b.(string)
+		if ok {
+			_, ok = c[s]
+		}
+		return ok
+	}
+	return false
+}
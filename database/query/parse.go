@@ -0,0 +1,387 @@
+// Package query parses and evaluates filter queries over JSON values, like
+//
+//	from order:* where status == "open" and total > 100 select customer.name, total limit 10
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/maracko/go-store/database/document"
+)
+
+// Query is a parsed query. All of it's clauses are optional
+type Query struct {
+	// From is a glob pattern keys must match, empty matches all keys
+	From string
+	// Where filters values, nil matches all of them
+	Where Expr
+	// Select are the fields returned instead of whole values
+	Select []Field
+	// Limit is the maximum number of results of a page, 0 leaves it to the database
+	Limit int
+	// Cursor continues a previous query from where it's page ended
+	Cursor string
+}
+
+// Field is a selected part of values, Name is how it's written in the query
+type Field struct {
+	Name string
+	expr Expr
+}
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tWord
+	tPath
+	tString
+	tNumber
+	tSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos)
+}
+
+// keywords are words which can't be used as unquoted field names
+var keywords = map[string]bool{
+	"from": true, "where": true, "select": true, "limit": true, "cursor": true,
+	"and": true, "or": true, "not": true, "contains": true, "in": true,
+	"true": true, "false": true, "null": true,
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// Parse parses a query made of clauses in this order: from pattern, where expression, select fields, limit n and cursor c.
+//
+// Expressions compare fields with == != < <= > >=, contains and in, and are combined with and, or, not and parentheses.
+// Fields are dot separated paths like customer.name or JSON Pointers in backquotes, $key is the key and $value
+// the whole value. Literals are JSON strings, numbers, true, false, null and arrays of literals
+func Parse(s string) (*Query, error) {
+	p := &parser{src: s}
+	q := &Query{}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if p.keyword("from") {
+		q.From = p.word()
+		if q.From == "" {
+			return nil, fmt.Errorf("missing pattern after from")
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("where") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		var err error
+		if q.Where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("select") {
+		for {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			start := p.tok.pos
+			e, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			q.Select = append(q.Select, Field{Name: strings.TrimSpace(p.src[start:p.tok.pos]), expr: e})
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("limit") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(p.tok.text)
+		if p.tok.kind != tNumber || err != nil || n <= 0 {
+			return nil, fmt.Errorf("limit must be a positive number, got %s", p.tok)
+		}
+		q.Limit = n
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("cursor") {
+		q.Cursor = p.word()
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tok.kind != tEOF {
+		return nil, fmt.Errorf("unexpected %s", p.tok)
+	}
+	return q, nil
+}
+
+// or parses expressions joined by or
+func (p *parser) or() (Expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = or{l, r}
+	}
+	return l, nil
+}
+
+// and parses expressions joined by and
+func (p *parser) and() (Expr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = and{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) not() (Expr, error) {
+	if p.keyword("not") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return not{e}, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses an operand optionally compared to another one
+func (p *parser) comparison() (Expr, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(p.tok.text)
+	switch {
+	case p.tok.kind == tSymbol && comparisons[op] != nil,
+		p.tok.kind == tWord && (op == "contains" || op == "in"):
+	default:
+		return l, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	r, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return compare{op, l, r}, nil
+}
+
+// operand parses a field, literal or parenthesized expression
+func (p *parser) operand() (Expr, error) {
+	t := p.tok
+	var e Expr
+	switch {
+	case t.kind == tSymbol && t.text == "(":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tSymbol || p.tok.text != ")" {
+			return nil, fmt.Errorf("expected ) instead of %s", p.tok)
+		}
+		e = inner
+	case t.kind == tSymbol && t.text == "[":
+		v, err := p.array()
+		if err != nil {
+			return nil, err
+		}
+		e = literal{v}
+	case t.kind == tString || t.kind == tNumber:
+		var v interface{}
+		if err := json.Unmarshal([]byte(t.text), &v); err != nil {
+			return nil, fmt.Errorf("invalid literal %s: %v", t, err)
+		}
+		e = literal{v}
+	case t.kind == tPath:
+		ptr, err := document.ParsePath(t.text)
+		if err != nil {
+			return nil, err
+		}
+		e = field(ptr)
+	case t.kind == tWord:
+		switch w := strings.ToLower(t.text); {
+		case w == "true" || w == "false" || w == "null":
+			var v interface{}
+			_ = json.Unmarshal([]byte(w), &v)
+			e = literal{v}
+		case keywords[w]:
+			return nil, fmt.Errorf("unexpected %s", t)
+		case t.text == "$key":
+			e = key{}
+		case t.text == "$value":
+			e = field(document.Pointer{})
+		case strings.HasPrefix(t.text, "$"):
+			return nil, fmt.Errorf("unknown variable %s", t)
+		default:
+			e = field(document.Pointer(strings.Split(t.text, ".")))
+		}
+	default:
+		return nil, fmt.Errorf("expected a field or value instead of %s", t)
+	}
+	return e, p.next()
+}
+
+// array parses an array of literals, leaving the closing bracket as the current token
+func (p *parser) array() ([]interface{}, error) {
+	res := []interface{}{}
+	for {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if len(res) == 0 && p.tok.kind == tSymbol && p.tok.text == "]" {
+			return res, nil
+		}
+		e, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := e.(literal)
+		if !ok {
+			return nil, fmt.Errorf("arrays can only contain values")
+		}
+		res = append(res, lit.v)
+		if p.tok.kind == tSymbol && p.tok.text == "]" {
+			return res, nil
+		}
+		if p.tok.kind != tSymbol || p.tok.text != "," {
+			return nil, fmt.Errorf("expected , or ] instead of %s", p.tok)
+		}
+	}
+}
+
+// keyword reports whether the current token is the keyword w
+func (p *parser) keyword(w string) bool {
+	return p.tok.kind == tWord && strings.EqualFold(p.tok.text, w)
+}
+
+// symbol reports whether the current token is the symbol s
+func (p *parser) symbol(s string) bool {
+	return p.tok.kind == tSymbol && p.tok.text == s
+}
+
+// word returns the text up to the next space, used for patterns and cursors which aren't tokenized
+func (p *parser) word() string {
+	rest := strings.TrimLeftFunc(p.src[p.pos:], unicode.IsSpace)
+	start := len(p.src) - len(rest)
+	end := strings.IndexFunc(rest, unicode.IsSpace)
+	if end < 0 {
+		end = len(rest)
+	}
+	p.pos = start + end
+	return rest[:end]
+}
+
+// next reads the next token
+func (p *parser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if start == len(p.src) {
+		p.tok = token{kind: tEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[start]
+	switch {
+	case c == '"':
+		end := start + 1
+		for ; end < len(p.src) && p.src[end] != '"'; end++ {
+			if p.src[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.src) {
+			return fmt.Errorf("unterminated string at %d", start)
+		}
+		p.pos = end + 1
+		p.tok = token{tString, p.src[start:p.pos], start}
+	case c == '`':
+		end := strings.IndexByte(p.src[start+1:], '`')
+		if end < 0 {
+			return fmt.Errorf("unterminated field at %d", start)
+		}
+		p.pos = start + end + 2
+		p.tok = token{tPath, p.src[start+1 : p.pos-1], start}
+	case c == '-' || c >= '0' && c <= '9':
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		p.tok = token{tNumber, p.src[start:p.pos], start}
+	case c == '$' || isWordChar(c) && c != '.' && (c < '0' || c > '9'):
+		p.pos++
+		for p.pos < len(p.src) && isWordChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{tWord, p.src[start:p.pos], start}
+	default:
+		for _, s := range []string{"==", "!=", "<=", ">=", "<", ">", "(", ")", "[", "]", ","} {
+			if strings.HasPrefix(p.src[start:], s) {
+				p.pos += len(s)
+				p.tok = token{tSymbol, s, start}
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected %q at %d", c, start)
+	}
+	return nil
+}
+
+// isWordChar reports whether c can be part of a keyword or unquoted field, bytes of non ASCII characters are accepted
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,72 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	var doc interface{}
+	_ = json.Unmarshal([]byte(`{"status":"open","total":150,"tags":["rush","gift"],
+		"customer":{"name":"Ana Horvat","vip":true},"my-field":1}`), &doc)
+
+	for where, expected := range map[string]bool{
+		`status == "open"`:                                true,
+		`status == "open" and total > 100`:                true,
+		`status == "open" and total > 200`:                false,
+		`total >= 150 and total <= 150`:                   true,
+		`status != "open" or customer.vip`:                true,
+		`not (status == "open")`:                          false,
+		`tags contains "gift"`:                            true,
+		`customer.name contains "Horvat"`:                 true,
+		`customer contains "vip"`:                         true,
+		`status in ["open", "pending"]`:                   true,
+		`"rush" in tags`:                                  true,
+		`missing == null and missing != 1`:                true,
+		`missing > 0 or total < "a"`:                      false,
+		"`/my-field` == 1 and `customer.vip` == true":     true,
+		`$key == "order:2" or $value == null`:             false,
+		`$key == "order:1" and $value contains "status"`:  true,
+		`status == "open" or total > 0 and total > 1000`:  true,
+		`(status == "open" or total > 0) and total > 1e3`: false,
+		`NOT status == "closed" AND tags != []`:           true,
+	} {
+		q, err := Parse("where " + where)
+		if err != nil {
+			t.Errorf("%s: %s", where, err)
+			continue
+		}
+		if got := q.Match("order:1", doc); got != expected {
+			t.Errorf("%s: expected %v, got %v", where, expected, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`from order:* where total > 1 select customer.name, total, $key limit 10 cursor abc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.From != "order:*" || q.Limit != 10 || q.Cursor != "abc" || len(q.Select) != 3 || q.Select[0].Name != "customer.name" {
+		t.Errorf("unexpected query %+v", q)
+	}
+
+	for _, s := range []string{
+		`where`,
+		`where status ==`,
+		`where (status == 1`,
+		`where status == "open`,
+		`where status = 1`,
+		`where $nope == 1`,
+		`where $value.status == 1`,
+		`where and`,
+		`limit 0`,
+		`limit x`,
+		`from`,
+		`select a limit 1 where a == 1`,
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// DefaultNamespace is the name of the namespace stored at the location the registry was created with
+const DefaultNamespace = "default"
+
+// validName restricts names of namespaces and indexes to characters which are safe in file names and URLs,
+// and never clash with backup or log suffixes
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Registry holds multiple named databases, each with it's own keyspace and file
+type Registry struct {
+	location   string
+	open       func(location string) *DB
+	namespaces map[string]*DB
+	mu         sync.Mutex
+}
+
+// NewRegistry creates a registry with the default namespace stored at location. Other namespaces are stored in
+// the location.ns directory and open creates their databases, it's called with an empty location if location is empty
+func NewRegistry(location string, open func(location string) *DB) *Registry {
+	return &Registry{
+		location:   location,
+		open:       open,
+		namespaces: map[string]*DB{DefaultNamespace: open(location)},
+	}
+}
+
+// Connect connects the default namespace and all namespaces found next to it
+func (r *Registry) Connect() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.namespaces[DefaultNamespace].Connect(); err != nil {
+		return err
+	}
+	if r.location == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(r.dir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !validName.MatchString(name) || name == DefaultNamespace {
+			continue
+		}
+		db := r.open(r.path(name))
+		if err := db.Connect(); err != nil {
+			return fmt.Errorf("namespace %s: %v", name, err)
+		}
+		r.namespaces[name] = db
+		log.Printf("Loaded namespace %s", name)
+	}
+	return nil
+}
+
+// Default returns the default namespace
+func (r *Registry) Default() *DB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.namespaces[DefaultNamespace]
+}
+
+// Get returns the namespace called name
+func (r *Registry) Get(name string) (*DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	db, ok := r.namespaces[name]
+	if !ok {
+		return nil, fmt.Errorf("namespace %s doesn't exist", name)
+	}
+	return db, nil
+}
+
+// Create creates and connects a new empty namespace
+func (r *Registry) Create(name string) (*DB, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid namespace name %q, use up to 64 letters, digits, _ or -", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.namespaces[name]; ok {
+		return nil, fmt.Errorf("namespace %s already exists", name)
+	}
+
+	if r.location != "" {
+		if err := os.MkdirAll(r.dir(), 0700); err != nil {
+			return nil, err
+		}
+	}
+	db := r.open(r.path(name))
+	if err := db.Connect(); err != nil {
+		return nil, err
+	}
+	r.namespaces[name] = db
+	return db, nil
+}
+
+// Drop disconnects a namespace and deletes all it's files. Writes through handles still held fail with ErrClosed
+func (r *Registry) Drop(name string) error {
+	if name == DefaultNamespace {
+		return fmt.Errorf("default namespace can't be dropped")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	db, ok := r.namespaces[name]
+	if !ok {
+		return fmt.Errorf("namespace %s doesn't exist", name)
+	}
+
+	delete(r.namespaces, name)
+	if err := db.Disconnect(); err != nil {
+		return err
+	}
+	if r.location == "" {
+		return nil
+	}
+	// names can't contain dots, so name.* only matches backups, logs and segments of this namespace
+	files, _ := filepath.Glob(filepath.Join(r.dir(), name+".*"))
+	for _, f := range append(files, r.path(name)) {
+		if err := os.RemoveAll(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns names of all namespaces in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.namespaces))
+	for name := range r.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Disconnect disconnects all namespaces
+func (r *Registry) Disconnect() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for name, db := range r.namespaces {
+		if derr := db.Disconnect(); derr != nil && err == nil {
+			err = fmt.Errorf("namespace %s: %v", name, derr)
+		}
+	}
+	return err
+}
+
+// CloseWatchers closes watchers of all namespaces
+func (r *Registry) CloseWatchers() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, db := range r.namespaces {
+		db.CloseWatchers()
+	}
+}
+
+func (r *Registry) dir() string {
+	return r.location + ".ns"
+}
+
+// path returns the file of a namespace, or an empty location if the registry is kept in memory
+func (r *Registry) path(name string) string {
+	if r.location == "" {
+		return ""
+	}
+	return filepath.Join(r.dir(), name)
+}
@@ -0,0 +1,50 @@
+package database
+
+import "strings"
+
+// Entry is a single key/value pair
+type Entry struct {
+	Key   string
+	Value interface{}
+}
+
+// ordered is implemented by engines which keep keys sorted. DB keeps it's own index for engines which don't,
+// or if keys are split into multiple shards
+type ordered interface {
+	Ascend(from string, fn func(key string, value interface{}) bool)
+}
+
+// Scan returns entries in lexicographic key order. Only keys starting with prefix and in range [start, end) are returned.
+// Empty prefix, start or end don't restrict the scan, limit of 0 returns all matching entries
+func (d *DB) Scan(prefix, start, end string, limit int) []Entry {
+	defer d.rlockAll()()
+
+	from := start
+	if prefix > from {
+		from = prefix
+	}
+
+	res := []Entry{}
+	d.ascend(from, func(k string, v interface{}) bool {
+		if (end != "" && k >= end) || !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if !d.expired(k) {
+			res = append(res, Entry{k, v})
+		}
+		return limit <= 0 || len(res) < limit
+	})
+	return res
+}
+
+// ascend visits keys greater than or equal to from in ascending order until fn returns false. Caller must lock all keys
+func (d *DB) ascend(from string, fn func(key string, value interface{}) bool) {
+	if d.index == nil {
+		d.shards[0].data.(ordered).Ascend(from, fn)
+		return
+	}
+	d.index.Ascend(from, func(k string, _ interface{}) bool {
+		v, _ := d.shardOf(k).data.Get(k)
+		return fn(k, v)
+	})
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/maracko/go-store/database/helpers"
+)
+
+// DefaultSegments is the number of segment files keys of a new database are split into unless set with WithSegments
+const DefaultSegments = 64
+
+// WithSegments splits keys of a new database into n segment files. Writes only replace segments holding changed keys,
+// so more segments make writes smaller. Existing databases keep their number of segments
+func WithSegments(n int) Option {
+	return func(d *DB) {
+		if n < 1 {
+			n = 1
+		}
+		d.segments = n
+	}
+}
+
+// segmentOf returns the segment key is stored in when keys are split into n segments
+func segmentOf(key string, n int) int {
+	return int(hashKey(key) % uint32(n))
+}
+
+// markDirty records that keys changed since the last write. Caller must lock keys
+func (d *DB) markDirty(keys ...string) {
+	for _, k := range keys {
+		d.shardOf(k).dirty[k] = struct{}{}
+	}
+}
+
+// changes describes what has to be written since the last write
+type changes struct {
+	segments map[int]bool
+	// all is set if every segment is written, replacing the existing ones
+	all     bool
+	indexes bool
+}
+
+// takeChanges returns changes since the last write and forgets them, false if there are none.
+// Caller must hold d.writeMu and lock all keys, at least for reading
+func (d *DB) takeChanges() (changes, bool) {
+	c := changes{segments: make(map[int]bool), indexes: d.indexesChanged}
+	for _, s := range d.shards {
+		if len(s.dirty) == 0 {
+			continue
+		}
+		for k := range s.dirty {
+			c.segments[segmentOf(k, d.segments)] = true
+		}
+		s.dirty = make(map[string]struct{})
+	}
+
+	failed := d.writeService.Failed()
+	if len(c.segments) == 0 && !c.indexes && !failed {
+		return c, false
+	}
+	c.all = d.fullWrite || failed
+	d.fullWrite = false
+	d.indexesChanged = false
+	return c, true
+}
+
+// readSegments merges keys of segment files in dir into snap and returns the number of segments.
+// Corrupt segments are read from their newest intact backup
+func readSegments(dir string, snap *helpers.Snapshot) (int, error) {
+	n := 1
+	for i := 0; i < n; i++ {
+		path := helpers.SegmentPath(dir, i)
+		seg, from, err := helpers.ReadLatestSnapshot(path)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read segment %s: %v", path, err)
+		}
+		if from != path {
+			log.Printf("Could not read %s, restored from backup %s", path, from)
+		}
+		if i == 0 {
+			if n = seg.Segments; n < 1 {
+				return 0, errors.New("invalid number of segments in " + from)
+			}
+		}
+
+		for k, v := range seg.Data {
+			snap.Data[k] = v
+		}
+		for k, exp := range seg.Expires {
+			snap.Expires[k] = exp
+		}
+		for k, v := range seg.Versions {
+			snap.Versions[k] = v
+		}
+		for k, t := range seg.Types {
+			snap.Types[k] = t
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Set is the value of keys created by set operations, a collection of unique string members.
+// Like lists, sets are never modified in place. They are encoded as a sorted JSON array
+type Set map[string]struct{}
+
+// MarshalJSON encodes s as a sorted array of it's members
+func (s Set) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.members())
+}
+
+// SAdd adds members to the set at key, creating it if it doesn't exist, and returns how many of them are new
+func (d *DB) SAdd(key string, members ...string) (int, error) {
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	s, err := d.set(key)
+	if err != nil {
+		return 0, err
+	}
+	if s == nil {
+		d.setExpiry(key, 0)
+	}
+	var ns Set
+	n := 0
+	for _, m := range members {
+		if _, ok := s[m]; ok {
+			continue
+		}
+		if ns == nil {
+			ns = s.copy(len(members))
+		}
+		if _, ok := ns[m]; !ok {
+			ns[m] = struct{}{}
+			n++
+		}
+	}
+	if n > 0 {
+		d.storeSet(key, ns)
+	}
+	return n, nil
+}
+
+// SRem removes members from the set at key and returns how many of them existed. The key is deleted if the set is left empty
+func (d *DB) SRem(key string, members ...string) (int, error) {
+	if err := d.checkOpen(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	s, err := d.set(key)
+	if err != nil {
+		return 0, err
+	}
+	var ns Set
+	n := 0
+	for _, m := range members {
+		if _, ok := s[m]; !ok {
+			continue
+		}
+		if ns == nil {
+			ns = s.copy(0)
+		}
+		if _, ok := ns[m]; ok {
+			delete(ns, m)
+			n++
+		}
+	}
+	if n > 0 {
+		d.storeSet(key, ns)
+	}
+	return n, nil
+}
+
+// SIsMember reports whether member is in the set at key
+func (d *DB) SIsMember(key, member string) (bool, error) {
+	defer d.rlock(key).mu.RUnlock()
+	s, err := d.set(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := s[member]
+	return ok, nil
+}
+
+// SMembers returns members of the set at key in alphabetical order, none if it doesn't exist
+func (d *DB) SMembers(key string) ([]string, error) {
+	defer d.rlock(key).mu.RUnlock()
+	s, err := d.set(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.members(), nil
+}
+
+// SCard returns the number of members of the set at key
+func (d *DB) SCard(key string) (int, error) {
+	defer d.rlock(key).mu.RUnlock()
+	s, err := d.set(key)
+	return len(s), err
+}
+
+// SInter returns members found in all sets at keys
+func (d *DB) SInter(keys ...string) ([]string, error) {
+	return d.setOp(inter, "", keys)
+}
+
+// SUnion returns members found in any of the sets at keys
+func (d *DB) SUnion(keys ...string) ([]string, error) {
+	return d.setOp(union, "", keys)
+}
+
+// SDiff returns members of the first set which are in none of the other ones
+func (d *DB) SDiff(keys ...string) ([]string, error) {
+	return d.setOp(diff, "", keys)
+}
+
+// SInterStore stores the intersection of sets at keys in dest, replacing it, and returns it's size
+func (d *DB) SInterStore(dest string, keys ...string) (int, error) {
+	res, err := d.setOp(inter, dest, keys)
+	return len(res), err
+}
+
+// SUnionStore stores the union of sets at keys in dest, replacing it, and returns it's size
+func (d *DB) SUnionStore(dest string, keys ...string) (int, error) {
+	res, err := d.setOp(union, dest, keys)
+	return len(res), err
+}
+
+// SDiffStore stores the difference of sets at keys in dest, replacing it, and returns it's size
+func (d *DB) SDiffStore(dest string, keys ...string) (int, error) {
+	res, err := d.setOp(diff, dest, keys)
+	return len(res), err
+}
+
+// Set algebra operations
+const (
+	inter = iota
+	union
+	diff
+)
+
+// setOp combines sets at keys and stores the result in dest unless it's empty
+func (d *DB) setOp(op int, dest string, keys []string) ([]string, error) {
+	if dest != "" {
+		if err := d.makeRoom(); err != nil {
+			return nil, err
+		}
+		defer d.lockKeys(append([]string{dest}, keys...)...)()
+	} else {
+		defer d.rlockKeys(keys...)()
+	}
+	sets := make([]Set, len(keys))
+	for i, k := range keys {
+		s, err := d.set(k)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = s
+	}
+
+	res := make(Set)
+	if len(sets) > 0 {
+		switch op {
+		case inter:
+			for m := range sets[0] {
+				if inAll(m, sets[1:]) {
+					res[m] = struct{}{}
+				}
+			}
+		case union:
+			for _, s := range sets {
+				for m := range s {
+					res[m] = struct{}{}
+				}
+			}
+		case diff:
+			for m := range sets[0] {
+				if !inAny(m, sets[1:]) {
+					res[m] = struct{}{}
+				}
+			}
+		}
+	}
+
+	if dest != "" {
+		if _, ok := d.lookup(dest); ok || len(res) > 0 {
+			d.setExpiry(dest, 0)
+			d.storeSet(dest, res)
+		}
+	}
+	return res.members(), nil
+}
+
+func inAll(m string, sets []Set) bool {
+	for _, s := range sets {
+		if _, ok := s[m]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func inAny(m string, sets []Set) bool {
+	for _, s := range sets {
+		if _, ok := s[m]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// members returns members of s in alphabetical order
+func (s Set) members() []string {
+	res := make([]string, 0, len(s))
+	for m := range s {
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// copy returns a copy of s with room for extra more members
+func (s Set) copy(extra int) Set {
+	c := make(Set, len(s)+extra)
+	for m := range s {
+		c[m] = struct{}{}
+	}
+	return c
+}
+
+// set returns the set at key, nil if it doesn't exist. Caller must lock key
+func (d *DB) set(key string) (Set, error) {
+	v, ok := d.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	s, ok := v.(Set)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return s, nil
+}
+
+// storeSet stores s under key, deleting the key if s is empty. Caller must lock key
+func (d *DB) storeSet(key string, s Set) {
+	if len(s) == 0 {
+		d.remove(key)
+	} else {
+		d.put(key, s)
+	}
+	d.changed(key)
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/maracko/go-store/database/engine"
+)
+
+// DefaultShards is the number of shards the keyspace is split into unless set with WithShards
+const DefaultShards = 32
+
+// shard holds the keys which hash to it, see shardOf. Every shard has it's own lock, so operations on keys in
+// different shards run in parallel and reads of keys in the same shard share the lock.
+//
+// Operations on a single key lock it's shard, operations on multiple keys lock all of their shards in order,
+// and operations on the whole keyspace or changing indexes lock all shards. State shared between shards is either
+// changed only while all shards are locked, guarded by it's own lock or accessed atomically, see DB
+type shard struct {
+	mu       sync.RWMutex
+	data     engine.Engine
+	expires  *engine.HAMT
+	versions *engine.HAMT
+	// pushed has a channel for each list with blocked pops, closed once something is pushed to it
+	pushed map[string]chan struct{}
+	// dirty holds keys changed since the last snapshot write, see segment.go
+	dirty map[string]struct{}
+
+	// memory use and accesses of keys, see memory.go. Reads update usage, so it has it's own lock
+	sizes   map[string]int64
+	usageMu sync.Mutex
+	usage   map[string]*usage
+}
+
+func newShard(data engine.Engine) *shard {
+	return &shard{
+		data:     data,
+		expires:  engine.NewHAMT(),
+		versions: engine.NewHAMT(),
+		pushed:   make(map[string]chan struct{}),
+		dirty:    make(map[string]struct{}),
+		sizes:    make(map[string]int64),
+		usage:    make(map[string]*usage),
+	}
+}
+
+// WithShards splits the keyspace into n shards, each with it's own lock. More shards let more operations on
+// different keys run in parallel, at the cost of operations on the whole keyspace locking all of them
+func WithShards(n int) Option {
+	return func(d *DB) {
+		if n < 1 {
+			n = 1
+		}
+		d.shards = make([]*shard, n)
+	}
+}
+
+// hashKey hashes key with FNV-1a, inlined so hashing doesn't allocate
+func hashKey(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// shardIndex returns the index of the shard holding key
+func (d *DB) shardIndex(key string) int {
+	return int(hashKey(key) % uint32(len(d.shards)))
+}
+
+// shardOf returns the shard holding key
+func (d *DB) shardOf(key string) *shard {
+	return d.shards[d.shardIndex(key)]
+}
+
+// lock locks key for writing and returns it's shard, unlocked with s.mu.Unlock
+func (d *DB) lock(key string) *shard {
+	s := d.shardOf(key)
+	s.mu.Lock()
+	return s
+}
+
+// rlock locks key for reading and returns it's shard, unlocked with s.mu.RUnlock
+func (d *DB) rlock(key string) *shard {
+	s := d.shardOf(key)
+	s.mu.RLock()
+	return s
+}
+
+// lockKeys locks all keys for writing and returns a function unlocking them
+func (d *DB) lockKeys(keys ...string) func() {
+	return d.lockShards(d.shardIndexes(keys), false)
+}
+
+// rlockKeys locks all keys for reading and returns a function unlocking them
+func (d *DB) rlockKeys(keys ...string) func() {
+	return d.lockShards(d.shardIndexes(keys), true)
+}
+
+// lockAll locks the whole database for writing and returns a function unlocking it
+func (d *DB) lockAll() func() {
+	return d.lockShards(d.allShards(), false)
+}
+
+// rlockAll locks the whole database for reading and returns a function unlocking it
+func (d *DB) rlockAll() func() {
+	return d.lockShards(d.allShards(), true)
+}
+
+// lockShards locks shards at sorted indexes, always locking in the same order so operations locking
+// multiple shards can't deadlock
+func (d *DB) lockShards(indexes []int, read bool) func() {
+	for _, i := range indexes {
+		if read {
+			d.shards[i].mu.RLock()
+		} else {
+			d.shards[i].mu.Lock()
+		}
+	}
+	return func() {
+		for _, i := range indexes {
+			if read {
+				d.shards[i].mu.RUnlock()
+			} else {
+				d.shards[i].mu.Unlock()
+			}
+		}
+	}
+}
+
+// shardIndexes returns sorted indexes of shards holding keys, without duplicates
+func (d *DB) shardIndexes(keys []string) []int {
+	seen := make(map[int]bool, len(keys))
+	indexes := make([]int, 0, len(keys))
+	for _, k := range keys {
+		if i := d.shardIndex(k); !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (d *DB) allShards() []int {
+	indexes := make([]int, len(d.shards))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// len returns the number of stored keys, including expired ones which weren't removed yet. Caller must lock all keys
+func (d *DB) len() int {
+	n := 0
+	for _, s := range d.shards {
+		n += s.data.Len()
+	}
+	return n
+}
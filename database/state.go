@@ -0,0 +1,119 @@
+package database
+
+import (
+	"time"
+
+	"github.com/maracko/go-store/database/engine"
+	"github.com/maracko/go-store/database/helpers"
+	"github.com/maracko/go-store/database/write"
+)
+
+// state is a consistent view of the database at a point in time. It's taken while all keys are locked but can be
+// read without any locks, since engines, expiries and versions are snapshotted and stored values are never
+// modified, only replaced
+type state struct {
+	// shards hold only snapshots of data, expires and versions
+	shards   []*shard
+	indexes  map[string]helpers.IndexDef
+	segments int
+	at       time.Time
+}
+
+// state captures the current state. It takes constant time for every shard unless the engine copies itself
+// on Snapshot. Caller must lock all keys, at least for reading
+func (d *DB) state() *state {
+	shards := make([]*shard, len(d.shards))
+	for i, s := range d.shards {
+		shards[i] = &shard{
+			data:     s.data.Snapshot(),
+			expires:  s.expires.Snapshot().(*engine.HAMT),
+			versions: s.versions.Snapshot().(*engine.HAMT),
+		}
+	}
+	return &state{shards: shards, indexes: d.indexDefs(), segments: d.segments, at: time.Now()}
+}
+
+// expired reports whether key of shard sh had expired at the time s was taken
+func (s *state) expired(sh *shard, key string) bool {
+	exp, ok := sh.expires.Get(key)
+	return ok && !s.at.Before(exp.(time.Time))
+}
+
+// len returns the number of keys, including expired ones
+func (s *state) len() int {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.data.Len()
+	}
+	return n
+}
+
+// writeData copies live keys of segments in c with their expiration times and versions into a write job
+func (s *state) writeData(c changes) write.WriteData {
+	segs := make(map[int]*helpers.Snapshot)
+	for i := 0; i < s.segments; i++ {
+		if c.all || c.segments[i] {
+			segs[i] = helpers.NewSnapshot(make(map[string]interface{}), make(map[string]time.Time), make(map[string]uint64), make(map[string]string))
+			segs[i].Segments = s.segments
+		}
+	}
+
+	for _, sh := range s.shardsOf(segs) {
+		sh.data.Iterate(func(k string, v interface{}) bool {
+			seg := segs[segmentOf(k, s.segments)]
+			if seg == nil || s.expired(sh, k) {
+				return true
+			}
+			seg.Data[k] = v
+			if exp, ok := sh.expires.Get(k); ok {
+				seg.Expires[k] = exp.(time.Time)
+			}
+			seg.Versions[k] = version(sh.versions, k)
+			if t := typeOf(v); t != "" {
+				seg.Types[k] = t
+			}
+			return true
+		})
+	}
+
+	// the write interval counts from when the state was taken, not when it was written
+	wd := write.WriteData{Time: s.at, Segments: segs, Full: c.all}
+	if c.all || c.indexes {
+		wd.Indexes = s.indexes
+	}
+	return wd
+}
+
+// shardsOf returns shards which may hold keys of segs. If the number of shards divides the number of segments,
+// all keys of a segment are in the same shard
+func (s *state) shardsOf(segs map[int]*helpers.Snapshot) []*shard {
+	if s.segments%len(s.shards) != 0 {
+		return s.shards
+	}
+	shards := []*shard{}
+	seen := make(map[int]bool)
+	for i := range segs {
+		if j := i % len(s.shards); !seen[j] {
+			seen[j] = true
+			shards = append(shards, s.shards[j])
+		}
+	}
+	return shards
+}
+
+// records returns log records recreating s, indexes first
+func (s *state) records() []*write.Record {
+	recs := make([]*write.Record, 0, len(s.indexes)+s.len())
+	for name, def := range s.indexes {
+		recs = append(recs, write.NewIndexRecord(name, def))
+	}
+	for _, sh := range s.shards {
+		sh.data.Iterate(func(k string, v interface{}) bool {
+			if !s.expired(sh, k) {
+				recs = append(recs, setRecord(k, v, sh.expires, sh.versions))
+			}
+			return true
+		})
+	}
+	return recs
+}
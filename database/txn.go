@@ -0,0 +1,124 @@
+package database
+
+import "fmt"
+
+// Tx is a transaction started by DB.Txn. Reads see the transaction's own writes,
+// which are only applied to the database once the transaction commits
+type Tx struct {
+	d      *DB
+	writes map[string]*txWrite
+	order  []string
+}
+
+type txWrite struct {
+	value   interface{}
+	deleted bool
+	// created keys don't keep the expiry of a previous, expired key
+	created bool
+}
+
+// Txn runs fn in a transaction. Changes made through tx are applied atomically if fn returns nil
+// and discarded if it returns an error. Keys fn uses aren't known upfront, so the whole database is locked
+// while fn runs and fn must only use tx and never call DB methods
+func (d *DB) Txn(fn func(tx *Tx) error) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	defer d.lockAll()()
+
+	tx := &Tx{d: d, writes: make(map[string]*txWrite)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if tx.grows() {
+		if err := d.evict(); err != nil {
+			return err
+		}
+	}
+	tx.commit()
+	return nil
+}
+
+// Read reads a single key
+func (tx *Tx) Read(key string) (interface{}, error) {
+	v, ok := tx.lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't exist", key)
+	}
+	return v, nil
+}
+
+// Create creates a new record
+func (tx *Tx) Create(key string, value interface{}) error {
+	if _, ok := tx.lookup(key); ok {
+		return fmt.Errorf("%s already exists", key)
+	}
+	tx.set(key, &txWrite{value: value, created: true})
+	return nil
+}
+
+// Update updates an existing record
+func (tx *Tx) Update(key string, value interface{}) error {
+	if _, ok := tx.lookup(key); !ok {
+		return fmt.Errorf("%s doesn't exist", key)
+	}
+	created := false
+	if w, ok := tx.writes[key]; ok {
+		created = w.created
+	}
+	tx.set(key, &txWrite{value: value, created: created})
+	return nil
+}
+
+// Delete deletes a single record
+func (tx *Tx) Delete(key string) error {
+	if _, ok := tx.lookup(key); !ok {
+		return fmt.Errorf("%s doesn't exist", key)
+	}
+	tx.set(key, &txWrite{deleted: true})
+	return nil
+}
+
+func (tx *Tx) lookup(key string) (interface{}, bool) {
+	if w, ok := tx.writes[key]; ok {
+		return w.value, !w.deleted
+	}
+	return tx.d.lookup(key)
+}
+
+func (tx *Tx) set(key string, w *txWrite) {
+	if _, ok := tx.writes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = w
+}
+
+// grows reports whether tx stores any values, transactions which only delete keys are allowed over the memory limit
+func (tx *Tx) grows() bool {
+	for _, w := range tx.writes {
+		if !w.deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// commit applies all writes to the database. Caller must lock all keys
+func (tx *Tx) commit() {
+	if len(tx.order) == 0 {
+		return
+	}
+	for _, k := range tx.order {
+		w := tx.writes[k]
+		switch {
+		case w.deleted:
+			tx.d.remove(k)
+		case w.created:
+			tx.d.put(k, w.value)
+			tx.d.setExpiry(k, 0)
+		default:
+			tx.d.put(k, w.value)
+		}
+	}
+	tx.d.changed(tx.order...)
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Names of native value types, persisted next to values so they are restored as the same type
+const (
+	TypeList = "list"
+	TypeHash = "hash"
+	TypeSet  = "set"
+	TypeZSet = "zset"
+)
+
+// ErrWrongType is returned when an operation for a native type is used on a key holding something else
+var ErrWrongType = errors.New("key holds the wrong kind of value")
+
+// typeOf returns the type name of v, or an empty string for plain values
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case List:
+		return TypeList
+	case Hash:
+		return TypeHash
+	case Set:
+		return TypeSet
+	case ZSet:
+		return TypeZSet
+	}
+	return ""
+}
+
+// restoreType converts a decoded value of key back to it's native type. Values which can't be converted are kept as they are
+func restoreType(key, typ string, v interface{}) interface{} {
+	switch typ {
+	case "":
+		return v
+	case TypeList:
+		if items, ok := v.([]interface{}); ok {
+			return List(items)
+		}
+	case TypeHash:
+		if fields, ok := v.(map[string]interface{}); ok {
+			return Hash(fields)
+		}
+	case TypeSet:
+		if members, ok := v.([]interface{}); ok {
+			return restoreSet(members)
+		}
+	case TypeZSet:
+		if members, ok := v.([]interface{}); ok {
+			if z, ok := restoreZSet(members); ok {
+				return z
+			}
+		}
+	}
+	log.Printf("Cannot restore %s as %q, keeping it as a plain value", key, typ)
+	return v
+}
+
+// restoreSet converts an array of members back to a set
+func restoreSet(members []interface{}) Set {
+	s := make(Set, len(members))
+	for _, m := range members {
+		s[fmt.Sprint(m)] = struct{}{}
+	}
+	return s
+}
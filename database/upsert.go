@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSetCondition is returned by Set when the key is skipped because of IfAbsent or IfPresent
+var ErrSetCondition = errors.New("set condition not met")
+
+// SetOptions changes how Set behaves, the zero value always sets the key without an expiry
+type SetOptions struct {
+	// IfAbsent only sets the key if it doesn't exist
+	IfAbsent bool
+	// IfPresent only sets the key if it exists
+	IfPresent bool
+	// TTL sets the key to expire after it, 0 means it never expires
+	TTL time.Duration
+	// KeepTTL keeps the current expiry of the key instead
+	KeepTTL bool
+}
+
+// Set stores value under key whether it exists or not, unless opts say otherwise.
+// It returns the previous value and whether there was one, also when the key is skipped with ErrSetCondition
+func (d *DB) Set(key string, value interface{}, opts SetOptions) (interface{}, bool, error) {
+	switch {
+	case opts.IfAbsent && opts.IfPresent:
+		return nil, false, errors.New("only one of if absent and if present can be set")
+	case opts.TTL < 0:
+		return nil, false, fmt.Errorf("invalid ttl %v", opts.TTL)
+	case opts.TTL > 0 && opts.KeepTTL:
+		return nil, false, errors.New("ttl can't be set while keeping the current one")
+	}
+	if err := d.makeRoom(); err != nil {
+		return nil, false, err
+	}
+	defer d.lock(key).mu.Unlock()
+
+	old, existed := d.lookup(key)
+	if (opts.IfAbsent && existed) || (opts.IfPresent && !existed) {
+		return old, existed, ErrSetCondition
+	}
+	d.put(key, value)
+	if !opts.KeepTTL || !existed {
+		d.setExpiry(key, opts.TTL)
+	}
+	d.changed(key)
+	return old, existed, nil
+}
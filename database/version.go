@@ -0,0 +1,76 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/maracko/go-store/database/engine"
+)
+
+// ErrVersionMismatch is returned by CompareAndSwap when the key was changed since the expected version was read
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// ErrMissingKey is returned by CompareAndSwap when a version of a key which doesn't exist is expected
+var ErrMissingKey = errors.New("key doesn't exist")
+
+// ReadWithVersion reads a single key along with it's version. Versions increase with every change of the key
+func (d *DB) ReadWithVersion(key string) (interface{}, uint64, error) {
+	defer d.rlock(key).mu.RUnlock()
+	v, ok := d.lookup(key)
+	if !ok {
+		return nil, 0, fmt.Errorf("%s doesn't exist", key)
+	}
+	return v, d.version(key), nil
+}
+
+// CompareAndSwap sets key to value only if it's still at version expected and returns the new version.
+// Expected version 0 means the key must not exist yet. The current expiry of the key is kept
+func (d *DB) CompareAndSwap(key string, expected uint64, value interface{}) (uint64, error) {
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+
+	_, ok := d.lookup(key)
+	switch {
+	case !ok && expected != 0:
+		return 0, fmt.Errorf("%w: %s", ErrMissingKey, key)
+	case !ok:
+		d.put(key, value)
+		d.setExpiry(key, 0)
+	case d.version(key) != expected:
+		return d.version(key), fmt.Errorf("%w: %s is at version %d, expected %d", ErrVersionMismatch, key, d.version(key), expected)
+	default:
+		d.put(key, value)
+	}
+
+	d.changed(key)
+	return d.version(key), nil
+}
+
+// restoreVersion sets the version of a key read from disk. Caller must lock key
+func (d *DB) restoreVersion(key string, version uint64) {
+	if version == 0 {
+		return
+	}
+	d.shardOf(key).versions.Put(key, version)
+	for {
+		revision := atomic.LoadUint64(&d.revision)
+		if version <= revision || atomic.CompareAndSwapUint64(&d.revision, revision, version) {
+			return
+		}
+	}
+}
+
+// version returns the version of key, 0 if it doesn't exist. Caller must lock key
+func (d *DB) version(key string) uint64 {
+	return version(d.shardOf(key).versions, key)
+}
+
+// version returns the version of key in versions, 0 if it doesn't exist
+func version(versions *engine.HAMT, key string) uint64 {
+	v, _ := versions.Get(key)
+	n, _ := v.(uint64)
+	return n
+}
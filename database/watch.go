@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// WatchBuffer is the number of events buffered for each watcher. Watchers which fall further behind are closed
+const WatchBuffer = 256
+
+// ErrWatchOverflow is reported by watchers closed because they didn't keep up with changes
+var ErrWatchOverflow = errors.New("watcher fell too far behind and was closed")
+
+// ErrWatchClosed is reported by watchers closed by the database shutting down
+var ErrWatchClosed = errors.New("database closed")
+
+// Event types
+const (
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventDelete = "delete"
+)
+
+// Event describes a single change of a key
+type Event struct {
+	Type    string      `json:"type"`
+	Key     string      `json:"key"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Version uint64      `json:"version,omitempty"`
+}
+
+// Watcher receives events for keys starting with a prefix
+type Watcher struct {
+	// Events receives changes in the order they were made. Changes of different keys made at the same time
+	// may arrive out of version order. It's closed once the watcher is closed
+	Events <-chan Event
+
+	d      *DB
+	prefix string
+	events chan Event
+	err    error
+}
+
+// Watch returns a watcher receiving events for every change of keys starting with prefix.
+// Watchers must be closed once they're no longer used
+func (d *DB) Watch(prefix string) *Watcher {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+
+	ch := make(chan Event, WatchBuffer)
+	w := &Watcher{Events: ch, d: d, prefix: prefix, events: ch}
+	if d.watchers == nil {
+		d.watchers = make(map[*Watcher]struct{})
+	}
+	d.watchers[w] = struct{}{}
+	atomic.StoreInt32(&d.watching, int32(len(d.watchers)))
+	return w
+}
+
+// Close stops the watcher and closes it's Events channel
+func (w *Watcher) Close() {
+	w.d.watchMu.Lock()
+	defer w.d.watchMu.Unlock()
+	w.d.dropWatcher(w, nil)
+}
+
+// Err returns why the watcher was closed by the database, or nil if it's open or was closed by calling Close
+func (w *Watcher) Err() error {
+	w.d.watchMu.Lock()
+	defer w.d.watchMu.Unlock()
+	return w.err
+}
+
+// CloseWatchers closes all watchers
+func (d *DB) CloseWatchers() {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+	for w := range d.watchers {
+		d.dropWatcher(w, ErrWatchClosed)
+	}
+}
+
+// watched reports whether there are any watchers, without locking d.watchMu
+func (d *DB) watched() bool {
+	return atomic.LoadInt32(&d.watching) > 0
+}
+
+// notify sends ev to every watcher of it's key. Caller must lock the key of ev
+func (d *DB) notify(ev Event) {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+	for w := range d.watchers {
+		if !strings.HasPrefix(ev.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			d.dropWatcher(w, ErrWatchOverflow)
+		}
+	}
+}
+
+// dropWatcher unregisters w and closes it's channel. Caller must hold d.watchMu
+func (d *DB) dropWatcher(w *Watcher, err error) {
+	if _, ok := d.watchers[w]; !ok {
+		return
+	}
+	delete(d.watchers, w)
+	atomic.StoreInt32(&d.watching, int32(len(d.watchers)))
+	w.err = err
+	close(w.events)
+}
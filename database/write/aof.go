@@ -0,0 +1,233 @@
+package write
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/maracko/go-store/database/helpers"
+)
+
+// FsyncPolicy decides how often the append-only log is flushed to disk
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs the log after every record
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncEverySec syncs the log once per second
+	FsyncEverySec FsyncPolicy = "everysec"
+	// FsyncNo leaves flushing to the OS
+	FsyncNo FsyncPolicy = "no"
+)
+
+// ParseFsyncPolicy validates policy name p
+func ParseFsyncPolicy(p string) (FsyncPolicy, error) {
+	switch FsyncPolicy(p) {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return FsyncPolicy(p), nil
+	}
+	return "", fmt.Errorf("unknown fsync policy %q, must be one of always, everysec, no", p)
+}
+
+// Log record operations
+const (
+	OpSet = "set"
+	OpDel = "del"
+	// OpIndex defines a secondary index named Key, Value holds it's definition
+	OpIndex = "index"
+	// OpDropIndex drops the secondary index named Key
+	OpDropIndex = "dropindex"
+)
+
+// Record is a single mutation in the append-only log
+type Record struct {
+	Op      string      `json:"op"`
+	Key     string      `json:"key"`
+	Value   interface{} `json:"value,omitempty"`
+	Expires *time.Time  `json:"expires,omitempty"`
+	Version uint64      `json:"version,omitempty"`
+	// Type of a native value like a list, empty for plain values
+	Type string `json:"type,omitempty"`
+}
+
+// NewSetRecord returns a record storing value under key. Zero expires means the key never expires
+func NewSetRecord(key string, value interface{}, expires time.Time, version uint64) *Record {
+	r := &Record{Op: OpSet, Key: key, Value: value, Version: version}
+	if !expires.IsZero() {
+		r.Expires = &expires
+	}
+	return r
+}
+
+// NewDelRecord returns a record deleting key
+func NewDelRecord(key string) *Record {
+	return &Record{Op: OpDel, Key: key}
+}
+
+// NewIndexRecord returns a record defining the secondary index name
+func NewIndexRecord(name string, def helpers.IndexDef) *Record {
+	return &Record{Op: OpIndex, Key: name, Value: def}
+}
+
+// NewDropIndexRecord returns a record dropping the secondary index name
+func NewDropIndexRecord(name string) *Record {
+	return &Record{Op: OpDropIndex, Key: name}
+}
+
+// LogPath returns location of the append-only log
+func (s *WriteService) LogPath() string {
+	return s.Path + ".aof"
+}
+
+// ReplayLog calls apply for every record in the log and returns the number of records read.
+// An incomplete record at the end of the log, left by a crash mid-write, is truncated
+func (s *WriteService) ReplayLog(apply func(*Record)) (int, error) {
+	f, err := os.Open(s.LogPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	var offset int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("Truncating incomplete record at offset %d of %s", offset, s.LogPath())
+				return n, os.Truncate(s.LogPath(), offset)
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		rec := &Record{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return n, fmt.Errorf("corrupt record at offset %d: %v", offset, err)
+		}
+		apply(rec)
+		offset += int64(len(line))
+		n++
+	}
+}
+
+// OpenLog opens the append-only log for writing with the given fsync policy
+func (s *WriteService) OpenLog(policy FsyncPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log != nil {
+		return errors.New("log already open")
+	}
+
+	f, err := os.OpenFile(s.LogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, helpers.FileMode)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.log = f
+	s.fsync = policy
+	s.logSize = info.Size()
+	s.rewriteBase = s.logSize
+
+	if policy == FsyncEverySec {
+		s.syncDone = make(chan struct{})
+		go s.syncEverySecond(s.syncDone)
+	}
+	return nil
+}
+
+// Append writes records to the end of the log
+func (s *WriteService) Append(recs ...*Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return errors.New("marshal error: " + err.Error())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return errors.New("log is not open")
+	}
+	n, err := s.log.Write(buf.Bytes())
+	s.logSize += int64(n)
+	if err != nil {
+		return errors.New("append error: " + err.Error())
+	}
+	if s.rewriting {
+		s.rewriteBuf.Write(buf.Bytes())
+	}
+
+	switch s.fsync {
+	case FsyncAlways:
+		if err := s.log.Sync(); err != nil {
+			return errors.New("sync error: " + err.Error())
+		}
+	case FsyncEverySec:
+		s.logDirty = true
+	}
+	return nil
+}
+
+// CloseLog syncs and closes the append-only log
+func (s *WriteService) CloseLog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	if s.syncDone != nil {
+		close(s.syncDone)
+		s.syncDone = nil
+	}
+
+	err := s.log.Sync()
+	if cerr := s.log.Close(); err == nil {
+		err = cerr
+	}
+	s.log = nil
+	return err
+}
+
+func (s *WriteService) syncEverySecond(done chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			var err error
+			s.mu.Lock()
+			if s.logDirty && s.log != nil {
+				err = s.log.Sync()
+				s.logDirty = false
+			}
+			s.mu.Unlock()
+			if err != nil {
+				s.ErrChan <- errors.New("sync error: " + err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package write
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/maracko/go-store/database/helpers"
+)
+
+const (
+	// DefaultRewriteMinSize is the default log size in bytes before automatic rewrites kick in
+	DefaultRewriteMinSize int64 = 64 << 20
+	// DefaultRewriteGrowth is the default growth in percent since the last rewrite which triggers a new one
+	DefaultRewriteGrowth = 100
+)
+
+// ErrRewriteInProgress is returned when a rewrite is requested while another one is running
+var ErrRewriteInProgress = errors.New("log rewrite already in progress")
+
+// ShouldRewrite reports whether the log has grown enough to be rewritten automatically
+func (s *WriteService) ShouldRewrite() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil || s.rewriting || s.RewriteGrowth <= 0 || s.logSize < s.RewriteMinSize {
+		return false
+	}
+	return s.logSize >= s.rewriteBase+s.rewriteBase*int64(s.RewriteGrowth)/100
+}
+
+// BeginRewrite starts buffering appended records so they can be carried over to the rewritten log.
+// It must be called while no records are being appended, at the moment the state passed to Rewrite is captured
+func (s *WriteService) BeginRewrite() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return errors.New("log is not open")
+	}
+	if s.rewriting {
+		return ErrRewriteInProgress
+	}
+	s.rewriting = true
+	s.rewriteBuf.Reset()
+	return nil
+}
+
+// Rewrite writes recs to a new log, followed by everything appended since BeginRewrite, and atomically replaces
+// the current log with it. The current log keeps receiving appends until it's replaced, so a failed rewrite loses nothing
+func (s *WriteService) Rewrite(recs []*Record) (err error) {
+	tmpPath := s.LogPath() + ".rewrite"
+	defer func() {
+		if err != nil {
+			s.mu.Lock()
+			s.rewriting = false
+			s.rewriteBuf.Reset()
+			s.mu.Unlock()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	log.Printf("Rewriting %s", s.LogPath())
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, helpers.FileMode)
+	if err != nil {
+		return errors.New("rewrite error: " + err.Error())
+	}
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return errors.New("marshal error: " + err.Error())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.New("rewrite error: " + err.Error())
+	}
+	if err := tmp.Sync(); err != nil {
+		return errors.New("sync error: " + err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return errors.New("log closed during rewrite")
+	}
+	// Records appended during the rewrite go last, the buffer can't grow while we hold the lock
+	if _, err := tmp.Write(s.rewriteBuf.Bytes()); err != nil {
+		return errors.New("rewrite error: " + err.Error())
+	}
+	if err := tmp.Sync(); err != nil {
+		return errors.New("sync error: " + err.Error())
+	}
+	if err := os.Rename(tmpPath, s.LogPath()); err != nil {
+		return errors.New("rename error: " + err.Error())
+	}
+	helpers.SyncDir(filepath.Dir(s.LogPath()))
+
+	f, err := os.OpenFile(s.LogPath(), os.O_WRONLY|os.O_APPEND, helpers.FileMode)
+	if err != nil {
+		// the old handle now points to an unlinked file, nothing appended to it would survive
+		s.log.Close()
+		s.log = nil
+		s.rewriting = false
+		return errors.New("cannot reopen log: " + err.Error())
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.New("cannot reopen log: " + err.Error())
+	}
+
+	s.log.Close()
+	s.log = f
+	s.logSize = info.Size()
+	s.rewriteBase = s.logSize
+	s.rewriting = false
+	s.rewriteBuf.Reset()
+	log.Printf("Rewrote %s with %d records, %d bytes", s.LogPath(), len(recs), s.logSize)
+	return nil
+}
@@ -0,0 +1,85 @@
+package write
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/maracko/go-store/database/helpers"
+)
+
+// writeSegments replaces segment files changed by job, see WriteData. Every segment file is replaced atomically,
+// but if writing is interrupted only some segments of the job may be written. They're written before the database
+// file, so a database file holding all keys is only replaced once all segments of a Full job are in place
+func (s *WriteService) writeSegments(job *WriteData) error {
+	dir := helpers.SegmentDir(s.Path)
+	if job.Full {
+		return replaceSegments(dir, job.Segments)
+	}
+
+	indexes := make([]int, 0, len(job.Segments))
+	for i := range job.Segments {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		if err := writeSnapshot(helpers.SegmentPath(dir, i), job.Segments[i], s.Backups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIndexes writes the database file, which holds only index definitions once keys are split into segments
+func (s *WriteService) writeIndexes(indexes map[string]helpers.IndexDef) error {
+	snap := helpers.NewSnapshot(map[string]interface{}{}, nil, nil, nil)
+	snap.Indexes = indexes
+	return writeSnapshot(s.Path, snap, s.Backups)
+}
+
+// replaceSegments writes segs to a new directory and moves it in place of dir, dropping existing segments along with
+// their backups. Until the new directory is in place existing segments are kept in helpers.OldSegmentDir, so if
+// replacing is interrupted either dir or the old directory holds a complete set of segments
+func replaceSegments(dir string, segs map[int]*helpers.Snapshot) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, snap := range segs {
+		if err := writeSnapshot(helpers.SegmentPath(tmp, i), snap, 0); err != nil {
+			return err
+		}
+	}
+
+	old := helpers.OldSegmentDir(dir)
+	if helpers.FileExists(dir) {
+		// an old directory left next to dir is outdated, dir is complete
+		if err := os.RemoveAll(old); err != nil {
+			return err
+		}
+		if err := os.Rename(dir, old); err != nil {
+			return err
+		}
+		helpers.SyncDir(filepath.Dir(dir))
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return err
+	}
+	helpers.SyncDir(filepath.Dir(dir))
+	return os.RemoveAll(old)
+}
+
+// writeSnapshot encodes snap and atomically writes it to f, keeping backups of it's previous contents
+func writeSnapshot(f string, snap *helpers.Snapshot, backups int) error {
+	data, err := helpers.EncodeSnapshot(snap)
+	if err != nil {
+		return errors.New("marshal error: " + err.Error())
+	}
+	if err := helpers.WriteFileAtomic(f, data, backups); err != nil {
+		return errors.New("write error: " + err.Error())
+	}
+	return nil
+}
@@ -1,11 +1,12 @@
 package write
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/maracko/go-store/database/helpers"
@@ -17,7 +18,28 @@ type WriteService struct {
 	WritesDone chan bool
 	ErrChan    chan error
 	Path       string
-	mu         sync.Mutex
+	// Backups is the number of previous snapshots kept next to Path
+	Backups int
+	mu      sync.Mutex
+	// failed is set while writes must be repeated by a write of all segments, accessed atomically so it's
+	// checked without waiting for a write in progress
+	failed int32
+
+	// RewriteMinSize is the size in bytes the append-only log must reach before it's automatically rewritten
+	RewriteMinSize int64
+	// RewriteGrowth is how many percent the log must grow since the last rewrite before it's rewritten again.
+	// Automatic rewrites are disabled if it's 0
+	RewriteGrowth int
+
+	// append-only log state, see aof.go and rewrite.go
+	log         *os.File
+	fsync       FsyncPolicy
+	logDirty    bool
+	syncDone    chan struct{}
+	logSize     int64
+	rewriteBase int64
+	rewriting   bool
+	rewriteBuf  bytes.Buffer
 }
 
 func NewWriteService(path string, jobs chan *WriteData, errs chan error, wd chan bool) *WriteService {
@@ -25,7 +47,8 @@ func NewWriteService(path string, jobs chan *WriteData, errs chan error, wd chan
 	if path != "" {
 		exists := helpers.FileExists(path)
 		if !exists {
-			writeable := os.WriteFile(path, []byte("{}"), 0777)
+			empty, _ := helpers.EncodeSnapshot(helpers.NewSnapshot(map[string]interface{}{}, nil, nil, nil))
+			writeable := helpers.WriteFileAtomic(path, empty, 0)
 			if writeable != nil {
 				log.Fatalln("file not writeable:", writeable)
 			}
@@ -37,32 +60,44 @@ func NewWriteService(path string, jobs chan *WriteData, errs chan error, wd chan
 		ErrChan:    errs,
 		Path:       path,
 		WritesDone: wd,
+
+		RewriteMinSize: DefaultRewriteMinSize,
+		RewriteGrowth:  DefaultRewriteGrowth,
 	}
 }
 
 func (s *WriteService) write(job *WriteData) error {
-	if job == nil || job.Data == nil {
+	if job == nil || job.Segments == nil {
 		return errors.New("received nil pointer")
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.Path == "" || !job.Time.After(s.LastWrite) {
+	if s.Path == "" {
 		return nil
 	}
 
-	data, err := json.Marshal(job.Data)
-	if err != nil {
-		return errors.New("marshal error: " + err.Error())
+	err := s.writeSegments(job)
+	if err == nil && (job.Full || job.Indexes != nil) {
+		err = s.writeIndexes(job.Indexes)
 	}
-	err = os.WriteFile(s.Path, data, 0777)
 	if err != nil {
-		return errors.New("write error: " + err.Error())
+		// later jobs hold only their own changes, so everything is written again by the next one
+		atomic.StoreInt32(&s.failed, 1)
+		return err
+	}
+	if job.Full {
+		atomic.StoreInt32(&s.failed, 0)
 	}
-	s.LastWrite = time.Now()
+	s.LastWrite = job.Time
 	return nil
 }
 
+// Failed reports whether a write failed since the last write of all segments
+func (s *WriteService) Failed() bool {
+	return atomic.LoadInt32(&s.failed) == 1
+}
+
 func (s *WriteService) Serve() {
 	for {
 		select {
@@ -85,7 +120,6 @@ func (s *WriteService) Serve() {
 			if !hasError {
 				log.Println("Clean exit")
 			}
-			close(s.ErrChan)
 			s.WritesDone <- true
 		case job := (<-s.JobsChan):
 			if err := s.write(job); err != nil {
@@ -95,11 +129,14 @@ func (s *WriteService) Serve() {
 	}
 }
 
+// WriteData holds the changes since the previous write job. Jobs only hold changed segments, so they must be
+// written in the order they were sent
 type WriteData struct {
 	Time time.Time
-	Data map[string]interface{}
-}
-
-func NewWriteData(data map[string]interface{}) WriteData {
-	return WriteData{time.Now(), data}
+	// Segments holds the full contents of changed segments by their number
+	Segments map[int]*helpers.Snapshot
+	// Full is set if Segments holds all segments, which replace the existing ones
+	Full bool
+	// Indexes are written to the database file along with Full jobs or if they're not nil
+	Indexes map[string]helpers.IndexDef
 }
@@ -0,0 +1,432 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ZSet is the value of keys created by sorted set operations, members ordered by a float score.
+// It's kept in two persistent trees, by member and by score, so every change copies only the path to the changed
+// member and sets handed out before stay unchanged. It's encoded as a JSON array of members ordered by score
+type ZSet struct {
+	byMember *znode
+	byScore  *znode
+}
+
+// ZMember is a member of a sorted set with it's score
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// Len returns the number of members
+func (z ZSet) Len() int {
+	return zsize(z.byMember)
+}
+
+// Members returns all members ordered by score
+func (z ZSet) Members() []ZMember {
+	res := make([]ZMember, 0, z.Len())
+	zascendRank(z.byScore, 0, func(n *znode) bool {
+		res = append(res, ZMember{n.member, n.score})
+		return true
+	})
+	return res
+}
+
+// MarshalJSON encodes z as an array of members ordered by score
+func (z ZSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(z.Members())
+}
+
+// score returns the score of member
+func (z ZSet) score(member string) (float64, bool) {
+	n := z.byMember
+	for n != nil {
+		switch {
+		case member < n.member:
+			n = n.left
+		case member > n.member:
+			n = n.right
+		default:
+			return n.score, true
+		}
+	}
+	return 0, false
+}
+
+// with returns z with member set to score
+func (z ZSet) with(member string, score float64) ZSet {
+	if old, ok := z.score(member); ok {
+		z.byScore = zremove(z.byScore, member, old, byScore)
+	}
+	z.byMember = zinsert(z.byMember, member, score, byMember)
+	z.byScore = zinsert(z.byScore, member, score, byScore)
+	return z
+}
+
+// without returns z without member
+func (z ZSet) without(member string) ZSet {
+	if old, ok := z.score(member); ok {
+		z.byMember = zremove(z.byMember, member, old, byMember)
+		z.byScore = zremove(z.byScore, member, old, byScore)
+	}
+	return z
+}
+
+// ZAdd sets scores of members of the sorted set at key, creating it if it doesn't exist, and returns how many members are new
+func (d *DB) ZAdd(key string, scores map[string]float64) (int, error) {
+	if len(scores) == 0 {
+		return 0, errors.New("nothing to add")
+	}
+	for m, s := range scores {
+		if err := checkScore(s); err != nil {
+			return 0, fmt.Errorf("%s: %v", m, err)
+		}
+	}
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	z, ok, err := d.zset(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		d.setExpiry(key, 0)
+	}
+	n := 0
+	for m, s := range scores {
+		if _, ok := z.score(m); !ok {
+			n++
+		}
+		z = z.with(m, s)
+	}
+	d.storeZSet(key, z)
+	return n, nil
+}
+
+// ZIncrBy adds delta to the score of member of the sorted set at key and returns the new score. A missing member counts as 0
+func (d *DB) ZIncrBy(key, member string, delta float64) (float64, error) {
+	if err := d.makeRoom(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	z, ok, err := d.zset(key)
+	if err != nil {
+		return 0, err
+	}
+	old, _ := z.score(member)
+	if err := checkScore(old + delta); err != nil {
+		return 0, err
+	}
+	if !ok {
+		d.setExpiry(key, 0)
+	}
+	d.storeZSet(key, z.with(member, old+delta))
+	return old + delta, nil
+}
+
+// ZRem removes members from the sorted set at key and returns how many of them existed. The key is deleted if nothing is left
+func (d *DB) ZRem(key string, members ...string) (int, error) {
+	if err := d.checkOpen(); err != nil {
+		return 0, err
+	}
+	defer d.lock(key).mu.Unlock()
+	z, _, err := d.zset(key)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range members {
+		if _, ok := z.score(m); ok {
+			z = z.without(m)
+			n++
+		}
+	}
+	if n > 0 {
+		d.storeZSet(key, z)
+	}
+	return n, nil
+}
+
+// ZRange returns members of the sorted set at key ranked from start to stop, both inclusive, ordered by score.
+// Negative ranks count from the end, -1 being the highest score
+func (d *DB) ZRange(key string, start, stop int) ([]ZMember, error) {
+	defer d.rlock(key).mu.RUnlock()
+	z, _, err := d.zset(key)
+	if err != nil {
+		return nil, err
+	}
+	start, stop = listRange(z.Len(), start, stop)
+	res := make([]ZMember, 0, stop-start)
+	zascendRank(z.byScore, start, func(n *znode) bool {
+		if len(res) == stop-start {
+			return false
+		}
+		res = append(res, ZMember{n.member, n.score})
+		return true
+	})
+	return res, nil
+}
+
+// ZRangeByScore returns members of the sorted set at key with scores between min and max, both inclusive.
+// A limit of 0 returns all of them
+func (d *DB) ZRangeByScore(key string, min, max float64, limit int) ([]ZMember, error) {
+	defer d.rlock(key).mu.RUnlock()
+	z, _, err := d.zset(key)
+	if err != nil {
+		return nil, err
+	}
+	res := []ZMember{}
+	zascendScore(z.byScore, min, func(n *znode) bool {
+		if n.score > max || (limit > 0 && len(res) == limit) {
+			return false
+		}
+		res = append(res, ZMember{n.member, n.score})
+		return true
+	})
+	return res, nil
+}
+
+// ZRank returns the rank of member in the sorted set at key, 0 being the lowest score, along with it's score
+func (d *DB) ZRank(key, member string) (int, float64, error) {
+	defer d.rlock(key).mu.RUnlock()
+	z, _, err := d.zset(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	score, ok := z.score(member)
+	if !ok {
+		return 0, 0, fmt.Errorf("%s is not a member of %s", member, key)
+	}
+	return zrank(z.byScore, member, score), score, nil
+}
+
+// ZCard returns the number of members of the sorted set at key
+func (d *DB) ZCard(key string) (int, error) {
+	defer d.rlock(key).mu.RUnlock()
+	z, _, err := d.zset(key)
+	return z.Len(), err
+}
+
+// zset returns the sorted set at key and whether it exists. Caller must lock key
+func (d *DB) zset(key string) (ZSet, bool, error) {
+	v, ok := d.lookup(key)
+	if !ok {
+		return ZSet{}, false, nil
+	}
+	z, ok := v.(ZSet)
+	if !ok {
+		return ZSet{}, false, ErrWrongType
+	}
+	return z, true, nil
+}
+
+// storeZSet stores z under key, deleting the key if z is empty. Caller must lock key
+func (d *DB) storeZSet(key string, z ZSet) {
+	if z.Len() == 0 {
+		d.remove(key)
+	} else {
+		d.put(key, z)
+	}
+	d.changed(key)
+}
+
+// checkScore rejects scores which can't be stored as JSON
+func checkScore(s float64) error {
+	if math.IsNaN(s) || math.IsInf(s, 0) {
+		return errors.New("score must be a finite number")
+	}
+	return nil
+}
+
+// restoreZSet converts an array of decoded members back to a sorted set
+func restoreZSet(members []interface{}) (ZSet, bool) {
+	var z ZSet
+	for _, v := range members {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ZSet{}, false
+		}
+		member, ok := m["member"].(string)
+		score, sok := m["score"].(float64)
+		if !ok || !sok {
+			return ZSet{}, false
+		}
+		z = z.with(member, score)
+	}
+	return z, true
+}
+
+// znode is a node of a persistent AVL tree. Nodes are never modified once created, changes copy them instead
+type znode struct {
+	member      string
+	score       float64
+	left, right *znode
+	height      int
+	size        int
+}
+
+// byMember orders nodes by member
+func byMember(m string, _ float64, n *znode) int {
+	switch {
+	case m < n.member:
+		return -1
+	case m > n.member:
+		return 1
+	}
+	return 0
+}
+
+// byScore orders nodes by score, then by member
+func byScore(m string, s float64, n *znode) int {
+	switch {
+	case s < n.score:
+		return -1
+	case s > n.score:
+		return 1
+	}
+	return byMember(m, s, n)
+}
+
+func zheight(n *znode) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func zsize(n *znode) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func znew(m string, s float64, left, right *znode) *znode {
+	h := zheight(left)
+	if hr := zheight(right); hr > h {
+		h = hr
+	}
+	return &znode{member: m, score: s, left: left, right: right, height: h + 1, size: zsize(left) + zsize(right) + 1}
+}
+
+// zbalance returns a new node with left and right children, rotated if they differ in height by more than one
+func zbalance(m string, s float64, left, right *znode) *znode {
+	hl, hr := zheight(left), zheight(right)
+	switch {
+	case hl > hr+1:
+		if zheight(left.left) >= zheight(left.right) {
+			return znew(left.member, left.score, left.left, znew(m, s, left.right, right))
+		}
+		lr := left.right
+		return znew(lr.member, lr.score, znew(left.member, left.score, left.left, lr.left), znew(m, s, lr.right, right))
+	case hr > hl+1:
+		if zheight(right.right) >= zheight(right.left) {
+			return znew(right.member, right.score, znew(m, s, left, right.left), right.right)
+		}
+		rl := right.left
+		return znew(rl.member, rl.score, znew(m, s, left, rl.left), znew(right.member, right.score, rl.right, right.right))
+	}
+	return znew(m, s, left, right)
+}
+
+func zinsert(n *znode, m string, s float64, cmp func(string, float64, *znode) int) *znode {
+	if n == nil {
+		return znew(m, s, nil, nil)
+	}
+	switch c := cmp(m, s, n); {
+	case c < 0:
+		return zbalance(n.member, n.score, zinsert(n.left, m, s, cmp), n.right)
+	case c > 0:
+		return zbalance(n.member, n.score, n.left, zinsert(n.right, m, s, cmp))
+	}
+	return znew(m, s, n.left, n.right)
+}
+
+func zremove(n *znode, m string, s float64, cmp func(string, float64, *znode) int) *znode {
+	if n == nil {
+		return nil
+	}
+	switch c := cmp(m, s, n); {
+	case c < 0:
+		return zbalance(n.member, n.score, zremove(n.left, m, s, cmp), n.right)
+	case c > 0:
+		return zbalance(n.member, n.score, n.left, zremove(n.right, m, s, cmp))
+	}
+	if n.left == nil {
+		return n.right
+	}
+	if n.right == nil {
+		return n.left
+	}
+	min := n.right
+	for min.left != nil {
+		min = min.left
+	}
+	return zbalance(min.member, min.score, n.left, zremoveMin(n.right))
+}
+
+func zremoveMin(n *znode) *znode {
+	if n.left == nil {
+		return n.right
+	}
+	return zbalance(n.member, n.score, zremoveMin(n.left), n.right)
+}
+
+// zrank returns the number of nodes ordered before member with score
+func zrank(n *znode, m string, s float64) int {
+	rank := 0
+	for n != nil {
+		switch c := byScore(m, s, n); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			rank += zsize(n.left) + 1
+			n = n.right
+		default:
+			return rank + zsize(n.left)
+		}
+	}
+	return rank
+}
+
+// zascendRank visits nodes in order, skipping the first skip of them, until fn returns false
+func zascendRank(n *znode, skip int, fn func(*znode) bool) bool {
+	if n == nil {
+		return true
+	}
+	if ls := zsize(n.left); skip < ls {
+		if !zascendRank(n.left, skip, fn) {
+			return false
+		}
+		skip = 0
+	} else {
+		skip -= ls
+	}
+	if skip == 0 {
+		if !fn(n) {
+			return false
+		}
+	} else {
+		skip--
+	}
+	return zascendRank(n.right, skip, fn)
+}
+
+// zascendScore visits nodes with a score of at least min in order until fn returns false
+func zascendScore(n *znode, min float64, fn func(*znode) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.score < min {
+		return zascendScore(n.right, min, fn)
+	}
+	if !zascendScore(n.left, min, fn) || !fn(n) {
+		return false
+	}
+	return zascendScore(n.right, min, fn)
+}
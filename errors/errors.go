@@ -120,3 +120,19 @@ func MethodNotAllowedWrap(err error, format string, args ...interface{}) error {
 		Err:    errors.Wrapf(err, format, args...),
 	}
 }
+
+// PreconditionFailed error
+func PreconditionFailed(format string, args ...interface{}) error {
+	return Error{
+		Status: http.StatusPreconditionFailed,
+		Err:    errors.Errorf(format, args...),
+	}
+}
+
+// PreconditionFailedWrap error wrap
+func PreconditionFailedWrap(err error, format string, args ...interface{}) error {
+	return Error{
+		Status: http.StatusPreconditionFailed,
+		Err:    errors.Wrapf(err, format, args...),
+	}
+}
@@ -5,6 +5,6 @@ go 1.16
 require (
 	github.com/pkg/errors v0.8.1
 	github.com/spf13/cobra v1.1.3
-	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/spf13/viper v1.10.1 // indirect
+	github.com/spf13/pflag v1.0.5
+	github.com/spf13/viper v1.10.1
 )
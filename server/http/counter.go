@@ -0,0 +1,64 @@
+package http
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// Counter atomically increments or decrements the number at key by the by query param, 1 if it's missing.
+// It's served under /_/incr/{key}, /_/decr/{key} and /_/incrbyfloat/{key}, missing keys start at 0
+func (s *httpServer) counter(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, typedPrefix)
+	i := strings.Index(p, "/")
+	op, key := p[:i], p[i+1:]
+	if key == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing key"))
+		return
+	}
+	if r.Method != "POST" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+	by := r.URL.Query().Get("by")
+
+	var v interface{}
+	var err error
+	if op == "incrbyfloat" {
+		delta, perr := strconv.ParseFloat(by, 64)
+		if perr != nil {
+			helpers.JSONEncode(w, errors.BadRequest("by must be a number"))
+			return
+		}
+		v, err = s.db.IncrByFloat(key, delta)
+	} else {
+		delta := int64(1)
+		if by != "" {
+			var perr error
+			if delta, perr = strconv.ParseInt(by, 10, 64); perr != nil {
+				helpers.JSONEncode(w, errors.BadRequest("by must be an integer"))
+				return
+			}
+		}
+		if op == "decr" {
+			v, err = s.db.DecrBy(key, delta)
+		} else {
+			v, err = s.db.IncrBy(key, delta)
+		}
+	}
+
+	if err != nil {
+		if stderrors.Is(err, database.ErrNotInteger) || stderrors.Is(err, database.ErrNotNumber) || err == database.ErrWrongType {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "type error"))
+			return
+		}
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "counter error"))
+		return
+	}
+	helpers.JSONEncode(w, resource{Key: key, Value: v})
+}
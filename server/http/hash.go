@@ -0,0 +1,129 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// field is a single field of a hash
+type field struct {
+	Key   string      `json:"key"`
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+// Hash handles operations on the hash at key, served under /{key}/fields/{field}: GET returns all fields without
+// a field, with one GET, HEAD, PUT and DELETE read, check, set and delete it and POST with ?incr=n increments it
+func (s *httpServer) hash(w http.ResponseWriter, r *http.Request) {
+	key, f, _ := hashPath(r.URL.EscapedPath())
+	if f == "" {
+		if r.Method != "GET" {
+			helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed without a field", r.Method))
+			return
+		}
+		fields, err := s.db.HGetAll(key)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "hash error"))
+			return
+		}
+		helpers.JSONEncode(w, fields)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		v, err := s.db.HGet(key, f)
+		if err != nil {
+			helpers.JSONEncode(w, readError(err, "hash"))
+			return
+		}
+		helpers.JSONEncode(w, field{Key: key, Field: f, Value: v})
+	case "HEAD":
+		ok, err := s.db.HExists(key, f)
+		switch {
+		case err != nil:
+			w.WriteHeader(http.StatusBadRequest)
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "PUT":
+		var v interface{}
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &v); err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "unmarshal error"))
+			return
+		}
+		created, err := s.db.HSet(key, f, v)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "hash error"))
+			return
+		}
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		helpers.JSONEncode(w, field{Key: key, Field: f, Value: v})
+	case "POST":
+		delta, err := strconv.ParseInt(r.URL.Query().Get("incr"), 10, 64)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequest("incr must be an integer"))
+			return
+		}
+		n, err := s.db.HIncrBy(key, f, delta)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "hash error"))
+			return
+		}
+		helpers.JSONEncode(w, field{Key: key, Field: f, Value: n})
+	case "DELETE":
+		n, err := s.db.HDel(key, f)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "hash error"))
+			return
+		}
+		if n == 0 {
+			helpers.JSONEncode(w, errors.NotFound("field %s of %s doesn't exist", f, key))
+			return
+		}
+		helpers.JSONEncode(w, map[string]bool{"deleted": true})
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+	}
+}
+
+// hashPath splits an escaped path like /{key}/fields/{field} into the key and field of a hash, field is empty in
+// /{key}/fields. The first fields segment after the key is reserved, keys containing one are written with the slash
+// before it escaped, like /a%2Ffields for key a/fields
+func hashPath(path string) (key, field string, ok bool) {
+	segs := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := 1; i < len(segs); i++ {
+		if segs[i] != "fields" {
+			continue
+		}
+		key, err := url.PathUnescape(strings.Join(segs[:i], "/"))
+		if err != nil || key == "" {
+			return "", "", false
+		}
+		field, err := url.PathUnescape(strings.Join(segs[i+1:], "/"))
+		if err != nil {
+			return "", "", false
+		}
+		return key, field, true
+	}
+	return "", "", false
+}
+
+// readError maps errors of reads from hashes and sorted sets to a status, kind names the type read from
+func readError(err error, kind string) error {
+	if err == database.ErrWrongType {
+		return errors.BadRequestWrap(err, "%s error", kind)
+	}
+	return errors.NotFoundWrap(err, "not found")
+}
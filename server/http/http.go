@@ -8,6 +8,7 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +22,16 @@ import (
 type resource struct {
 	Key   string      `json:"key"`
 	Value interface{} `json:"value"`
+	// TTL is the number of seconds until the key expires
+	TTL int64 `json:"ttl,omitempty"`
+	// Version increases with every change of the key, it's also sent as the ETag header
+	Version uint64 `json:"version,omitempty"`
+}
+
+// cursorPage is a single page of a cursor scan
+type cursorPage struct {
+	Cursor string   `json:"cursor"`
+	Keys   []string `json:"keys"`
 }
 
 var key string
@@ -30,16 +41,19 @@ func init() {
 }
 
 // New create new server
-func New(port, tlsPort int, token, pKey, cert string, db *database.DB, wg *sync.WaitGroup) server.Server {
+func New(port, tlsPort int, token, pKey, cert string, ns *database.Registry, wg *sync.WaitGroup) server.Server {
 	srv := &http.Server{
 		Addr: ":" + fmt.Sprint(port),
 	}
+	// End watch streams so shutdown doesn't wait on them
+	srv.RegisterOnShutdown(ns.CloseWatchers)
 	s := &httpServer{
 		port:  port,
 		token: token,
 		pKey:  pKey,
 		cert:  cert,
-		db:    db,
+		ns:    ns,
+		db:    ns.Default(),
 		srv:   srv,
 		wg:    wg,
 	}
@@ -52,8 +66,10 @@ type httpServer struct {
 	tlsPort           int
 	token, pKey, cert string
 	wg                *sync.WaitGroup
-	db                *database.DB
-	srv               *http.Server
+	ns                *database.Registry
+	// db is the namespace requests are served from, the default one unless routed through /ns/{name}
+	db  *database.DB
+	srv *http.Server
 }
 
 // Clean stops http/s and disconnects the db
@@ -72,23 +88,16 @@ func (s *httpServer) Clean() error {
 	}
 	log.Println("HTTP/S shut down")
 
-	return s.db.Disconnect()
+	return s.ns.Disconnect()
 }
 
 // Serve starts the HTTP server
 func (s *httpServer) Serve() {
 	key = s.token
-	// Map of all endpoints
-	endpoints := map[string]http.HandlerFunc{
-		"/": s.handle,
-	}
-
-	// Add middleware from []commonMiddleware to each endpoint
-	for endpoint, f := range endpoints {
-		http.HandleFunc(endpoint, multipleMiddleware(f, commonMiddleware...))
-	}
+	// Only / is registered and routed by dispatch, so http.ServeMux never redirects a key like /_ to /_/
+	http.HandleFunc("/", multipleMiddleware(s.dispatch, commonMiddleware...))
 
-	err := s.db.Connect()
+	err := s.ns.Connect()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -115,6 +124,43 @@ func (s *httpServer) Serve() {
 
 }
 
+// typedPrefix is the reserved path prefix of operations on lists, sets, sorted sets and counters
+const typedPrefix = "/_/"
+
+// Dispatch serves a request from the default namespace, or from a namespace under /ns/
+func (s *httpServer) dispatch(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/ns":
+		s.listNamespaces(w, r)
+	case strings.HasPrefix(r.URL.Path, "/ns/"):
+		s.namespace(w, r)
+	default:
+		s.route(r)(w, r)
+	}
+}
+
+// Map of all endpoints served for a namespace
+func (s *httpServer) endpoints() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/":                          s.handle,
+		"/admin/rewrite":             s.rewrite,
+		"/admin/memory":              s.memory,
+		"/txn":                       s.txn,
+		"/watch":                     s.watch,
+		typedPrefix + "lists/":       s.list,
+		typedPrefix + "members/":     s.set,
+		typedPrefix + "sets/":        s.setAlgebra,
+		typedPrefix + "scores/":      s.zset,
+		typedPrefix + "incr/":        s.counter,
+		typedPrefix + "decr/":        s.counter,
+		typedPrefix + "incrbyfloat/": s.counter,
+		"/fields/":                   s.hash,
+		"/indexes":                   s.listIndexes,
+		"/indexes/":                  s.index,
+		"/query":                     s.query,
+	}
+}
+
 // Handle appropriate func based on method and params
 func (s *httpServer) handle(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -122,6 +168,9 @@ func (s *httpServer) handle(w http.ResponseWriter, r *http.Request) {
 		keys := helpers.ExtractKeys(r)
 
 		switch {
+		case r.URL.Path == "/":
+			s.scan(w, r)
+			return
 		case len(keys) == 0:
 			helpers.JSONEncode(w, errors.BadRequest("missing key"))
 			return
@@ -137,6 +186,8 @@ func (s *httpServer) handle(w http.ResponseWriter, r *http.Request) {
 		s.create(w, r)
 	case "PATCH":
 		s.update(w, r)
+	case "PUT":
+		s.put(w, r)
 	case "DELETE":
 		keys := helpers.ExtractKeys(r)
 
@@ -159,14 +210,23 @@ func (s *httpServer) handle(w http.ResponseWriter, r *http.Request) {
 // Read read database key
 func (s *httpServer) read(w http.ResponseWriter, r *http.Request) {
 	key := strings.TrimPrefix(r.URL.Path, "/")
+	if _, ok := r.URL.Query()["path"]; ok {
+		s.readPath(w, r, key)
+		return
+	}
 
-	val, err := s.db.Read(key)
+	val, version, err := s.db.ReadWithVersion(key)
 	if err != nil {
 		helpers.JSONEncode(w, errors.NotFoundWrap(err, "not found"))
 		return
 	}
 
-	helpers.JSONEncode(w, resource{key, val})
+	w.Header().Set("ETag", etag(version))
+	res := resource{Key: key, Value: val, Version: version}
+	if ttl, err := s.db.TTL(key); err == nil && ttl != database.NoExpiry {
+		res.TTL = int64(ttl.Round(time.Second) / time.Second)
+	}
+	helpers.JSONEncode(w, res)
 }
 
 // ReadMany read many records
@@ -191,11 +251,57 @@ func (s *httpServer) readMany(w http.ResponseWriter, r *http.Request) {
 	resp := []resource{}
 
 	for k, v := range res {
-		resp = append(resp, resource{k, v})
+		resp = append(resp, resource{Key: k, Value: v})
 	}
 	helpers.JSONEncode(w, resp)
 }
 
+// Scan returns keys in lexicographic order, filtered by prefix, start and end query params
+func (s *httpServer) scan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if _, ok := q["cursor"]; ok {
+		s.scanCursor(w, r)
+		return
+	}
+
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			helpers.JSONEncode(w, errors.BadRequest("limit must be a positive number"))
+			return
+		}
+	}
+
+	resp := []resource{}
+	for _, e := range s.db.Scan(q.Get("prefix"), q.Get("start"), q.Get("end"), limit) {
+		resp = append(resp, resource{Key: e.Key, Value: e.Value})
+	}
+	helpers.JSONEncode(w, resp)
+}
+
+// ScanCursor returns a page of keys matching a glob pattern, continuing from cursor query param
+func (s *httpServer) scanCursor(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	count := 0
+	if c := q.Get("count"); c != "" {
+		var err error
+		if count, err = strconv.Atoi(c); err != nil || count < 0 {
+			helpers.JSONEncode(w, errors.BadRequest("count must be a positive number"))
+			return
+		}
+	}
+
+	keys, next, err := s.db.ScanCursor(q.Get("cursor"), q.Get("match"), count)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "scan error"))
+		return
+	}
+
+	helpers.JSONEncode(w, cursorPage{Cursor: next, Keys: keys})
+}
+
 // Create create new value
 func (s *httpServer) create(w http.ResponseWriter, r *http.Request) {
 	var res resource
@@ -209,16 +315,26 @@ func (s *httpServer) create(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := s.db.Create(res.Key, res.Value); err != nil {
+	if res.TTL < 0 {
+		helpers.JSONEncode(w, errors.BadRequest("ttl must not be negative"))
+		return
+	}
+
+	if err := s.db.CreateWithTTL(res.Key, res.Value, time.Duration(res.TTL)*time.Second); err != nil {
 		helpers.JSONEncode(w, errors.BadRequestWrap(err, "duplicate key"))
 		return
 	}
 
-	helpers.JSONEncode(w, resource{res.Key, res.Value})
+	helpers.JSONEncode(w, res)
 }
 
 // Update update key
 func (s *httpServer) update(w http.ResponseWriter, r *http.Request) {
+	if mt := patchType(r); mt != "" {
+		s.patch(w, r, mt)
+		return
+	}
+
 	var res resource
 	b, _ := ioutil.ReadAll(r.Body)
 	if err := json.Unmarshal(b, &res); err != nil {
@@ -226,12 +342,22 @@ func (s *httpServer) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.db.Update(res.Key, res.Value); err != nil {
+	if res.TTL < 0 {
+		helpers.JSONEncode(w, errors.BadRequest("ttl must not be negative"))
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		s.compareAndSwap(w, res, ifMatch)
+		return
+	}
+
+	if err := s.db.UpdateWithTTL(res.Key, res.Value, time.Duration(res.TTL)*time.Second); err != nil {
 		helpers.JSONEncode(w, errors.BadRequestWrap(err, "update error"))
 		return
 	}
 
-	helpers.JSONEncode(w, resource{res.Key, res.Value})
+	helpers.JSONEncode(w, res)
 }
 
 // Delete delete key
@@ -250,7 +376,7 @@ func (s *httpServer) delete(w http.ResponseWriter, r *http.Request) {
 
 	del := make(map[string]bool)
 	del["deleted"] = true
-	helpers.JSONEncode(w, resource{res.Key, del})
+	helpers.JSONEncode(w, resource{Key: res.Key, Value: del})
 }
 
 func (s *httpServer) deleteMany(w http.ResponseWriter, r *http.Request) {
@@ -286,7 +412,32 @@ func (s *httpServer) deleteMany(w http.ResponseWriter, r *http.Request) {
 
 	resp := []resource{}
 	for k, v := range res {
-		resp = append(resp, resource{k, v})
+		resp = append(resp, resource{Key: k, Value: v})
 	}
 	helpers.JSONEncode(w, resp)
 }
+
+// Rewrite starts compacting the append-only log in the background
+func (s *httpServer) rewrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+
+	if err := s.db.BackgroundRewriteLog(); err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "rewrite error"))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	helpers.JSONEncode(w, map[string]bool{"rewriting": true})
+}
+
+// Memory returns memory use and eviction counters
+func (s *httpServer) memory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+	helpers.JSONEncode(w, s.db.MemoryStats())
+}
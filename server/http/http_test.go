@@ -1,7 +1,11 @@
 package http
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 
@@ -10,7 +14,7 @@ import (
 )
 
 var port int
-var db *database.DB
+var ns *database.Registry
 var srv *httpServer
 var path string
 
@@ -21,8 +25,10 @@ func init() {
 	dc := make(chan bool)
 	path = ".test.file"
 
-	db = database.New(path, false, true, errChan, dc, 1)
-	s := New(port, tlsPort, "", "", "", db, &sync.WaitGroup{})
+	ns = database.NewRegistry(path, func(l string) *database.DB {
+		return database.New(l, false, true, errChan, dc, 1)
+	})
+	s := New(port, tlsPort, "", "", "", ns, &sync.WaitGroup{})
 	srv = s.(*httpServer)
 }
 
@@ -48,3 +54,375 @@ func TestClean(t *testing.T) {
 	}
 
 }
+
+// newTestServer returns a server over an in-memory database opened with opts
+func newTestServer(t *testing.T, opts ...database.Option) *httpServer {
+	t.Helper()
+	reg := database.NewRegistry("", func(l string) *database.DB {
+		return database.New(l, true, false, make(chan error, 10), make(chan bool), 0, opts...)
+	})
+	if err := reg.Connect(); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	t.Cleanup(func() { _ = reg.Disconnect() })
+	return New(0, 0, "", "", "", reg, &sync.WaitGroup{}).(*httpServer)
+}
+
+// serve makes a request to s and returns the response
+func serve(s *httpServer, method, target, body string) *httptest.ResponseRecorder {
+	return do(s, httptest.NewRequest(method, target, strings.NewReader(body)))
+}
+
+// do serves r through an http.ServeMux set up like Serve does and returns the response
+func do(s *httpServer, r *http.Request) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.dispatch)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// expect fails t unless the response has status code and it's body contains want
+func expect(t *testing.T, w *httptest.ResponseRecorder, code int, want string) {
+	t.Helper()
+	if w.Code != code || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected %d with %q, got %d %s", code, want, w.Code, w.Body.String())
+	}
+}
+
+// expectNotAllowed fails t unless the method of the request was rejected
+func expectNotAllowed(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code < 400 || !strings.Contains(w.Body.String(), "not allowed") {
+		t.Errorf("expected method to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestList(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/_/lists/q", `["b","c"]`), 200, `"len":2`)
+	expect(t, serve(s, "POST", "/_/lists/q?end=left", `["a"]`), 200, `"len":3`)
+	expect(t, serve(s, "GET", "/_/lists/q", ""), 200, `["a","b","c"]`)
+	expect(t, serve(s, "GET", "/_/lists/q?start=1&stop=1", ""), 200, `["b"]`)
+	expect(t, serve(s, "GET", "/_/lists/q?len", ""), 200, `"len":3`)
+	expect(t, serve(s, "DELETE", "/_/lists/q?end=left", ""), 200, `"value":"a"`)
+	expect(t, serve(s, "DELETE", "/_/lists/q", ""), 200, `"value":"c"`)
+	expect(t, serve(s, "POST", "/_/lists/q?trim&start=1", ""), 200, `"len":0`)
+	expect(t, serve(s, "DELETE", "/_/lists/q", ""), 404, "pop error")
+	expect(t, serve(s, "DELETE", "/_/lists/q?end=middle", ""), 400, "invalid end")
+	expect(t, serve(s, "POST", "/_/lists/q", `{}`), 400, "JSON array")
+	expectNotAllowed(t, serve(s, "PUT", "/_/lists/q", ""))
+	expect(t, serve(s, "GET", "/_/lists/", ""), 400, "missing key")
+
+	// keys named like list operations are plain keys
+	expect(t, serve(s, "POST", "/", `{"key":"a/list/left","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/a/list/left", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "DELETE", "/a/list/left", `{"key":"a/list/left"}`), 200, "deleted")
+	expect(t, serve(s, "POST", "/_/lists/a/list", `[1]`), 200, `"key":"a/list"`)
+	for _, k := range []string{"lists", "lists/q", "_", "_lists"} {
+		expect(t, serve(s, "POST", "/", `{"key":"`+k+`","value":"x"}`), 200, `"x"`)
+		expect(t, serve(s, "GET", "/"+k, ""), 200, `"value":"x"`)
+	}
+
+	// namespaces route the same paths the same way
+	expect(t, serve(s, "PUT", "/ns/x", ""), 201, `"x"`)
+	expect(t, serve(s, "POST", "/ns/x/_/lists/q", `[1]`), 200, `"len":1`)
+	expect(t, serve(s, "POST", "/ns/x/", `{"key":"lists","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/ns/x/lists", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "GET", "/_/lists/q?len", ""), 200, `"len":0`)
+
+	_ = s.db.Create("plain", "x")
+	expect(t, serve(s, "POST", "/_/lists/plain", `[1]`), 400, "push error")
+	expect(t, serve(s, "DELETE", "/_/lists/plain", ""), 400, "pop error")
+}
+
+func TestHash(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "PUT", "/user:1/fields/name", `"ana"`), 201, `"value":"ana"`)
+	expect(t, serve(s, "PUT", "/user:1/fields/name", `"ivo"`), 200, `"value":"ivo"`)
+	expect(t, serve(s, "GET", "/user:1/fields/name", ""), 200, `"value":"ivo"`)
+	expect(t, serve(s, "HEAD", "/user:1/fields/name", ""), 200, "")
+	expect(t, serve(s, "HEAD", "/user:1/fields/age", ""), 404, "")
+	expect(t, serve(s, "POST", "/user:1/fields/visits?incr=2", ""), 200, `"value":2`)
+	expect(t, serve(s, "POST", "/user:1/fields/visits?incr=x", ""), 400, "incr must be an integer")
+	expect(t, serve(s, "GET", "/user:1/fields", ""), 200, `{"name":"ivo","visits":2}`)
+	expect(t, serve(s, "GET", "/user:1/fields/", ""), 200, `{"name":"ivo","visits":2}`)
+	expect(t, serve(s, "GET", "/user:1/fields/age", ""), 404, "not found")
+	expect(t, serve(s, "DELETE", "/user:1/fields/age", ""), 404, "doesn't exist")
+	expect(t, serve(s, "DELETE", "/user:1/fields/name", ""), 200, "deleted")
+	expect(t, serve(s, "PUT", "/user:1/fields/name", `{`), 400, "unmarshal error")
+	expectNotAllowed(t, serve(s, "PUT", "/user:1/fields", `"x"`))
+	expect(t, serve(s, "PUT", "/ns/x", ""), 201, `"x"`)
+	expect(t, serve(s, "PUT", "/ns/x/user:1/fields/name", `"eva"`), 201, `"key":"user:1","field":"name"`)
+
+	// the first fields segment after the key is reserved, the slash before it is escaped in keys containing one
+	expect(t, serve(s, "PUT", "/a/fields/b/fields/c", `1`), 201, `"key":"a","field":"b/fields/c"`)
+	expect(t, serve(s, "PUT", "/a%2Ffields/fields/b", `1`), 201, `"key":"a/fields","field":"b"`)
+	expect(t, serve(s, "GET", "/a%2Ffields/fields", ""), 200, `{"b":1}`)
+	expect(t, serve(s, "POST", "/", `{"key":"b/fields/c","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/b%2Ffields/c", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "GET", "/ns/x/b%2Ffields/c", ""), 404, "not found")
+	expect(t, serve(s, "GET", "/b/fields/c", ""), 404, "not found")
+	expect(t, serve(s, "POST", "/", `{"key":"fields","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/fields", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "PUT", "/ns/x/fields/fields/a", `1`), 201, `"key":"fields","field":"a"`)
+
+	_ = s.db.Create("plain", "x")
+	expect(t, serve(s, "GET", "/plain/fields/a", ""), 400, "hash error")
+	expect(t, serve(s, "PUT", "/plain/fields/a", `1`), 400, "hash error")
+}
+
+func TestSet(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/_/members/tags", `["go","db"]`), 200, `"card":2`)
+	expect(t, serve(s, "PUT", "/_/members/tags?member=kv", ""), 201, `"member":"kv"`)
+	expect(t, serve(s, "PUT", "/_/members/tags?member=kv", ""), 200, `"member":"kv"`)
+	expect(t, serve(s, "GET", "/_/members/tags?member=go", ""), 200, `"member":"go"`)
+	expect(t, serve(s, "GET", "/_/members/tags?member=js", ""), 404, "not a member")
+	expect(t, serve(s, "GET", "/_/members/tags", ""), 200, `["db","go","kv"]`)
+	expect(t, serve(s, "GET", "/_/members/tags?card", ""), 200, `"card":3`)
+	expect(t, serve(s, "DELETE", "/_/members/tags?member=js", ""), 404, "not a member")
+	expect(t, serve(s, "DELETE", "/_/members/tags?member=kv", ""), 200, "deleted")
+	expect(t, serve(s, "POST", "/_/members/tags", `[1]`), 400, "JSON array of strings")
+	expectNotAllowed(t, serve(s, "DELETE", "/_/members/tags", ""))
+
+	_, _ = s.db.SAdd("other", "go", "js")
+	expect(t, serve(s, "GET", "/_/sets/inter?keys=tags,other", ""), 200, `["go"]`)
+	expect(t, serve(s, "POST", "/_/sets/union?keys=tags,other&store=all", ""), 200, `"card":3`)
+	expect(t, serve(s, "GET", "/_/sets/xor?keys=tags", ""), 404, "unknown set operation")
+	expect(t, serve(s, "POST", "/_/sets/union?keys=tags", ""), 400, "missing store key")
+
+	// keys named like set operations are plain keys
+	expect(t, serve(s, "POST", "/", `{"key":"a/members","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/a/members", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "PUT", "/_/members/b/members?member=c/d", ""), 201, `"key":"b/members","member":"c/d"`)
+	for _, k := range []string{"members", "members/tags", "sets", "sets/inter"} {
+		expect(t, serve(s, "POST", "/", `{"key":"`+k+`","value":"x"}`), 200, `"x"`)
+		expect(t, serve(s, "GET", "/"+k, ""), 200, `"value":"x"`)
+	}
+
+	_ = s.db.Create("plain", "x")
+	expect(t, serve(s, "GET", "/_/members/plain?member=a", ""), 400, "set error")
+	expect(t, serve(s, "POST", "/_/members/plain", `["a"]`), 400, "set error")
+}
+
+func TestZSet(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/_/scores/board", `{"ana":3,"ivo":1.5}`), 200, `"card":2`)
+	expect(t, serve(s, "POST", "/_/scores/board?member=ivo&incr=2", ""), 200, `"score":3.5,"rank":1`)
+	expect(t, serve(s, "POST", "/_/scores/board?member=ivo&incr=x", ""), 400, "incr must be a number")
+	expect(t, serve(s, "GET", "/_/scores/board?member=ana", ""), 200, `"score":3,"rank":0`)
+	expect(t, serve(s, "GET", "/_/scores/board?member=eva", ""), 404, "not found")
+	expect(t, serve(s, "GET", "/_/scores/board?start=-1", ""), 200, `[{"member":"ivo","score":3.5}]`)
+	expect(t, serve(s, "GET", "/_/scores/board?min=3&max=3", ""), 200, `[{"member":"ana","score":3}]`)
+	expect(t, serve(s, "GET", "/_/scores/board?min=x", ""), 400, "invalid range")
+	expect(t, serve(s, "GET", "/_/scores/board?card", ""), 200, `"card":2`)
+	expect(t, serve(s, "DELETE", "/_/scores/board?member=eva", ""), 404, "not a member")
+	expect(t, serve(s, "DELETE", "/_/scores/board?member=ana", ""), 200, "deleted")
+	expect(t, serve(s, "POST", "/_/scores/board", `["ana"]`), 400, "JSON object of scores")
+	expectNotAllowed(t, serve(s, "PUT", "/_/scores/board", ""))
+
+	// keys named like sorted set operations are plain keys
+	expect(t, serve(s, "POST", "/", `{"key":"a/scores/b","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/a/scores/b", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "POST", "/_/scores/b/scores", `{"c/d":1}`), 200, `"key":"b/scores","card":1`)
+	for _, k := range []string{"scores", "scores/board"} {
+		expect(t, serve(s, "POST", "/", `{"key":"`+k+`","value":"x"}`), 200, `"x"`)
+		expect(t, serve(s, "GET", "/"+k, ""), 200, `"value":"x"`)
+	}
+
+	_ = s.db.Create("plain", "x")
+	expect(t, serve(s, "POST", "/_/scores/plain", `{"a":1}`), 400, "sorted set error")
+	expect(t, serve(s, "GET", "/_/scores/plain?member=a", ""), 400, "sorted set error")
+}
+
+func TestCounter(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/_/incr/hits", ""), 200, `"value":1`)
+	expect(t, serve(s, "POST", "/_/incr/hits?by=5", ""), 200, `"value":6`)
+	expect(t, serve(s, "POST", "/_/decr/hits?by=2", ""), 200, `"value":4`)
+	expect(t, serve(s, "POST", "/_/incrbyfloat/price?by=0.5", ""), 200, `"value":0.5`)
+	expect(t, serve(s, "POST", "/_/incr/hits?by=x", ""), 400, "by must be an integer")
+	expect(t, serve(s, "POST", "/_/incrbyfloat/price", ""), 400, "by must be a number")
+	expect(t, serve(s, "POST", "/_/incr/", ""), 400, "missing key")
+	expectNotAllowed(t, serve(s, "GET", "/_/incr/hits", ""))
+
+	// keys named like counter operations are plain keys
+	expect(t, serve(s, "POST", "/", `{"key":"a/incr","value":"x"}`), 200, `"x"`)
+	expect(t, serve(s, "GET", "/a/incr", ""), 200, `"value":"x"`)
+	expect(t, serve(s, "DELETE", "/a/incr", `{"key":"a/incr"}`), 200, "deleted")
+	expect(t, serve(s, "POST", "/_/incr/b/decr", ""), 200, `"key":"b/decr","value":1`)
+	for _, k := range []string{"incr", "decr/hits", "incrbyfloat"} {
+		expect(t, serve(s, "POST", "/", `{"key":"`+k+`","value":"x"}`), 200, `"x"`)
+		expect(t, serve(s, "GET", "/"+k, ""), 200, `"value":"x"`)
+	}
+	expect(t, serve(s, "PUT", "/ns/x", ""), 201, `"x"`)
+	expect(t, serve(s, "POST", "/ns/x/_/incr/hits", ""), 200, `"value":1`)
+	expect(t, serve(s, "GET", "/ns/x/incr", ""), 404, "not found")
+
+	_ = s.db.Create("plain", "x")
+	expect(t, serve(s, "POST", "/_/incr/plain", ""), 400, "type error")
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	s := newTestServer(t)
+	ifMatch := func(method, target, body, tag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("If-Match", tag)
+		return do(s, r)
+	}
+
+	w := ifMatch("PATCH", "/", `{"key":"a","value":1}`, `"0"`)
+	expect(t, w, 200, `"version":1`)
+	if w.Header().Get("ETag") != `"1"` {
+		t.Errorf("expected ETag of the new version, got %s", w.Header().Get("ETag"))
+	}
+	expect(t, ifMatch("PATCH", "/", `{"key":"a","value":2}`, `W/"1"`), 200, `"version":2`)
+	w = ifMatch("PATCH", "/", `{"key":"a","value":3}`, `"1"`)
+	expect(t, w, 412, "version mismatch")
+	if w.Header().Get("ETag") != `"2"` {
+		t.Errorf("expected ETag of the current version, got %s", w.Header().Get("ETag"))
+	}
+	expect(t, ifMatch("PATCH", "/", `{"key":"b","value":1}`, `"1"`), 404, "doesn't exist")
+	expect(t, ifMatch("PATCH", "/", `{"key":"a","value":1}`, `1`), 400, "invalid If-Match header")
+	expect(t, ifMatch("PATCH", "/", `{"key":"a","value":1,"ttl":5}`, `"2"`), 400, "ttl can't be set")
+
+	// errors other than a missing key are mapped like other updates
+	s = newTestServer(t, database.WithMaxMemory(1, database.NoEviction))
+	_ = s.db.Create("a", "x")
+	expect(t, ifMatch("PATCH", "/", `{"key":"a","value":1}`, `"1"`), 400, "over it's memory limit")
+}
+
+func TestPut(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "PUT", "/a", `{"value":1,"ttl":100}`), 201, `"key":"a","value":1`)
+	expect(t, serve(s, "PUT", "/a?keepttl", `{"value":2}`), 200, `"value":2`)
+	expect(t, serve(s, "GET", "/a", ""), 200, `"ttl":100`)
+	expect(t, serve(s, "PUT", "/a?get", `{"value":3}`), 200, `"value":2`)
+	expect(t, serve(s, "PUT", "/a?nx", `{"value":4}`), 412, "set error")
+	expect(t, serve(s, "PUT", "/b?xx", `{"value":4}`), 412, "set error")
+	expect(t, serve(s, "PUT", "/b?nx&get", `{"value":4}`), 201, `"value":null`)
+	expect(t, serve(s, "PUT", "/a?nx&get", `{"value":4}`), 412, `{"error":"set error: `)
+	expect(t, serve(s, "PUT", "/a?nx&get", `{"value":4}`), 412, `"key":"a","value":3`)
+	expect(t, serve(s, "PUT", "/c?xx&get", `{"value":4}`), 412, `"key":"c","value":null`)
+	expect(t, serve(s, "PUT", "/a", `{"key":"b","value":4}`), 400, "doesn't match")
+	expect(t, serve(s, "PUT", "/a", `{"value":`), 400, "unmarshal error")
+	expect(t, serve(s, "PUT", "/", `{"value":4}`), 400, "missing key")
+	expect(t, serve(s, "GET", "/a", ""), 200, `"value":3`)
+	expect(t, serve(s, "PUT", "/a?nx&xx", `{"value":4}`), 400, "set error")
+}
+
+func TestPatch(t *testing.T) {
+	s := newTestServer(t)
+	patch := func(contentType, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", target, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return do(s, r)
+	}
+
+	expect(t, serve(s, "POST", "/", `{"key":"doc","value":{"a":1,"b":{"c":2}}}`), 200, `"doc"`)
+	expect(t, patch(jsonPatch, "/doc", `[{"op":"replace","path":"/a","value":5},{"op":"add","path":"/b/d","value":3}]`),
+		200, `"value":{"a":5,"b":{"c":2,"d":3}}`)
+	expect(t, patch(jsonPatch+"; charset=utf-8", "/doc", `[{"op":"test","path":"/a","value":1}]`), 412, "patch error")
+	expect(t, patch(jsonPatch, "/doc", `[{"op":"remove","path":"/x"}]`), 400, "patch error")
+	expect(t, patch(jsonPatch, "/doc", `{"op":"remove"}`), 400, "unmarshal error")
+	expect(t, patch(jsonPatch, "/missing", `[{"op":"add","path":"/a","value":1}]`), 404, "patch error")
+	expect(t, patch(mergePatch, "/doc", `{"a":null,"b":{"c":4}}`), 200, `"value":{"b":{"c":4,"d":3}}`)
+	expect(t, patch(mergePatch, "/", `{}`), 400, "missing key")
+	expect(t, serve(s, "GET", "/doc", ""), 200, `"value":{"b":{"c":4,"d":3}}`)
+
+	_ = s.db.Create("plain", "x")
+	expect(t, patch(jsonPatch, "/plain", `[{"op":"add","path":"/a","value":1}]`), 400, "patch error")
+
+	// If-Match is refused rather than ignored
+	r := httptest.NewRequest("PATCH", "/doc", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", mergePatch)
+	r.Header.Set("If-Match", `"1"`)
+	expect(t, do(s, r), 400, "If-Match can't be used")
+}
+
+func TestReadPath(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/", `{"key":"doc","value":{"a":{"b/c":[1,{"d":"x"}]}}}`), 200, `"doc"`)
+	expect(t, serve(s, "GET", "/doc?path=/a/b~1c/1/d", ""), 200, `"key":"doc","path":"/a/b~1c/1/d","value":"x"`)
+	expect(t, serve(s, "GET", "/doc?path=a", ""), 200, `"value":{"b/c":[1,{"d":"x"}]}`)
+	expect(t, serve(s, "GET", "/doc?path=", ""), 200, `"path":"","value":{"a"`)
+	expect(t, serve(s, "GET", "/doc?path=a.e", ""), 404, "not found")
+	expect(t, serve(s, "GET", "/missing?path=a", ""), 404, "not found")
+	expect(t, serve(s, "GET", "/doc?path=/a/~2", ""), 400, "invalid path")
+
+	_, _ = s.db.HSet("user", "name", "ana")
+	expect(t, serve(s, "GET", "/user?path=name", ""), 200, `"value":"ana"`)
+	_, _ = s.db.SAdd("tags", "a")
+	expect(t, serve(s, "GET", "/tags?path=a", ""), 400, "path error")
+}
+
+func TestIndex(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/", `{"key":"user:1","value":{"age":30,"name":"ana"}}`), 200, `"user:1"`)
+	expect(t, serve(s, "POST", "/", `{"key":"user:2","value":{"age":25,"name":"ivo"}}`), 200, `"user:2"`)
+	expect(t, serve(s, "PUT", "/indexes/age", `{"prefix":"user:","path":"age"}`), 201, `"name":"age","prefix":"user:","path":"age"`)
+	expect(t, serve(s, "PUT", "/indexes/age", `{"prefix":"user:","path":"age"}`), 400, "already exists")
+	expect(t, serve(s, "PUT", "/indexes/bad%20name", `{"prefix":"user:","path":"age"}`), 400, "index error")
+	expect(t, serve(s, "PUT", "/indexes/name", `[]`), 400, "body must be a JSON object")
+	expect(t, serve(s, "GET", "/indexes", ""), 200, `[{"name":"age","prefix":"user:","path":"age"}]`)
+	expectNotAllowed(t, serve(s, "POST", "/indexes", ""))
+
+	expect(t, serve(s, "GET", "/indexes/age?value=30", ""), 200, `[{"key":"user:1"`)
+	expect(t, serve(s, "GET", "/indexes/age?min=20&max=30", ""), 200, `[{"key":"user:2"`)
+	expect(t, serve(s, "GET", "/indexes/age?min=20&limit=1", ""), 200, `[{"key":"user:2","value":{"age":25,"name":"ivo"}}]`)
+	expect(t, serve(s, "GET", "/indexes/age?value=40", ""), 200, `[]`)
+	expect(t, serve(s, "GET", "/indexes/age?value=%5B1%5D", ""), 400, "index error")
+	expect(t, serve(s, "GET", "/indexes/age?value=30&limit=x", ""), 400, "limit must be a positive number")
+	expect(t, serve(s, "GET", "/indexes/name?value=ana", ""), 404, "not found")
+	expectNotAllowed(t, serve(s, "POST", "/indexes/age", ""))
+
+	expect(t, serve(s, "DELETE", "/indexes/age", ""), 200, `"dropped":true`)
+	expect(t, serve(s, "DELETE", "/indexes/age", ""), 404, "not found")
+}
+
+func TestQuery(t *testing.T) {
+	s := newTestServer(t)
+
+	expect(t, serve(s, "POST", "/", `{"key":"order:1","value":{"total":50,"name":"ana"}}`), 200, `"order:1"`)
+	expect(t, serve(s, "POST", "/", `{"key":"order:2","value":{"total":150,"name":"ivo"}}`), 200, `"order:2"`)
+	expect(t, serve(s, "POST", "/", `{"key":"order:3","value":{"total":250,"name":"eva"}}`), 200, `"order:3"`)
+	expect(t, serve(s, "POST", "/", `{"key":"user:1","value":{"total":500}}`), 200, `"user:1"`)
+
+	expect(t, serve(s, "GET", "/query?q=from%20order:*%20where%20total%20%3E%20100%20select%20name", ""),
+		200, `{"cursor":"0","results":[{"key":"order:2","value":{"name":"ivo"}},{"key":"order:3","value":{"name":"eva"}}]}`)
+	expect(t, serve(s, "POST", "/query", `from order:* where name == "ana"`), 200, `"results":[{"key":"order:1"`)
+	expect(t, serve(s, "POST", "/query", `where total >`), 400, "query error")
+	expect(t, serve(s, "POST", "/query?limit=0", ``), 400, "limit must be a positive number")
+	expect(t, serve(s, "POST", "/query?cursor=x", ``), 400, "query error")
+	expectNotAllowed(t, serve(s, "PUT", "/query", ""))
+
+	// limit and cursor params page through the same query
+	var page queryPage
+	var keys []string
+	for cursor := "0"; ; cursor = page.Cursor {
+		w := serve(s, "POST", "/query?limit=1&cursor="+cursor, `from order:* where total > 100 limit 5`)
+		expect(t, w, 200, `"results"`)
+		page = queryPage{}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range page.Results {
+			keys = append(keys, r.Key)
+		}
+		if page.Cursor == "0" || len(keys) > 2 {
+			break
+		}
+	}
+	if strings.Join(keys, " ") != "order:2 order:3" {
+		t.Errorf("expected order:2 order:3 in pages, got %v", keys)
+	}
+}
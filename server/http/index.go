@@ -0,0 +1,97 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/document"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// ListIndexes returns all secondary indexes
+func (s *httpServer) listIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+	helpers.JSONEncode(w, s.db.Indexes())
+}
+
+// Index handles /indexes/{name}: PUT creates the index from a JSON body with prefix and path, DELETE drops it
+// and GET looks up keys whose field equals the value query param, or is between min and max query params
+func (s *httpServer) index(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/indexes/")
+	switch r.Method {
+	case "GET":
+		s.find(w, r, name)
+	case "PUT":
+		var def database.Index
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &def); err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "body must be a JSON object with prefix and path"))
+			return
+		}
+		if err := s.db.CreateIndex(name, def.Prefix, def.Path); err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "index error"))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		helpers.JSONEncode(w, database.Index{Name: name, Prefix: def.Prefix, Path: def.Path})
+	case "DELETE":
+		if err := s.db.DropIndex(name); err != nil {
+			helpers.JSONEncode(w, errors.NotFoundWrap(err, "not found"))
+			return
+		}
+		helpers.JSONEncode(w, map[string]bool{"dropped": true})
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+	}
+}
+
+// find returns entries of index name matching the value, min, max and limit query params.
+// Values are parsed as JSON, falling back to plain strings
+func (s *httpServer) find(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			helpers.JSONEncode(w, errors.BadRequest("limit must be a positive number"))
+			return
+		}
+	}
+
+	var entries []database.Entry
+	var err error
+	if _, ok := q["value"]; ok {
+		entries, err = s.db.Find(name, document.ParseValue(q.Get("value")), limit)
+	} else {
+		var min, max interface{}
+		if _, ok := q["min"]; ok {
+			min = document.ParseValue(q.Get("min"))
+		}
+		if _, ok := q["max"]; ok {
+			max = document.ParseValue(q.Get("max"))
+		}
+		entries, err = s.db.FindRange(name, min, max, limit)
+	}
+	switch {
+	case err == database.ErrNotIndexable:
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "index error"))
+		return
+	case err != nil:
+		helpers.JSONEncode(w, errors.NotFoundWrap(err, "not found"))
+		return
+	}
+
+	resp := []resource{}
+	for _, e := range entries {
+		resp = append(resp, resource{Key: e.Key, Value: e.Value})
+	}
+	helpers.JSONEncode(w, resp)
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// listLen is returned by operations changing the length of a list
+type listLen struct {
+	Key string `json:"key"`
+	Len int    `json:"len"`
+}
+
+// List handles operations on the list at key, served under /_/lists/{key}: GET returns a range or it's length with ?len,
+// POST pushes to and DELETE pops from the end in the end query param, right if it's missing, and POST with ?trim trims it
+func (s *httpServer) list(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, typedPrefix+"lists/")
+	if key == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing key"))
+		return
+	}
+	q := r.URL.Query()
+	_, length := q["len"]
+	_, trim := q["trim"]
+	left, err := endParam(r)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "invalid end"))
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && length:
+		n, err := s.db.LLen(key)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "list error"))
+			return
+		}
+		helpers.JSONEncode(w, listLen{Key: key, Len: n})
+	case r.Method == "GET":
+		s.listRange(w, r, key)
+	case r.Method == "POST" && trim:
+		s.listTrim(w, r, key)
+	case r.Method == "POST":
+		s.listPush(w, r, key, left)
+	case r.Method == "DELETE":
+		s.listPop(w, r, key, left)
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+	}
+}
+
+// endParam reports whether the end query param selects the left end of a list
+func endParam(r *http.Request) (bool, error) {
+	switch end := r.URL.Query().Get("end"); end {
+	case "", "right":
+		return false, nil
+	case "left":
+		return true, nil
+	default:
+		return false, fmt.Errorf("end must be left or right, got %s", end)
+	}
+}
+
+// ListRange returns elements between start and stop query params, the whole list if they're missing
+func (s *httpServer) listRange(w http.ResponseWriter, r *http.Request, key string) {
+	start, stop, err := rangeParams(r)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "invalid range"))
+		return
+	}
+	items, err := s.db.LRange(key, start, stop)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "list error"))
+		return
+	}
+	helpers.JSONEncode(w, items)
+}
+
+// ListPush pushes a JSON array of values to either end of a list
+func (s *httpServer) listPush(w http.ResponseWriter, r *http.Request, key string, left bool) {
+	var values []interface{}
+	b, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(b, &values); err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "body must be a JSON array"))
+		return
+	}
+
+	push := s.db.RPush
+	if left {
+		push = s.db.LPush
+	}
+	n, err := push(key, values...)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "push error"))
+		return
+	}
+	helpers.JSONEncode(w, listLen{Key: key, Len: n})
+}
+
+// ListPop pops from either end of a list. With a timeout query param, in seconds, it waits for an element
+// if the list is empty, 0 waits until the client gives up
+func (s *httpServer) listPop(w http.ResponseWriter, r *http.Request, key string, left bool) {
+	var v interface{}
+	var err error
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		secs, perr := strconv.Atoi(t)
+		if perr != nil || secs < 0 {
+			helpers.JSONEncode(w, errors.BadRequest("timeout must be a positive number of seconds"))
+			return
+		}
+		pop := s.db.BRPop
+		if left {
+			pop = s.db.BLPop
+		}
+		v, err = pop(r.Context(), key, time.Duration(secs)*time.Second)
+	} else if left {
+		v, err = s.db.LPop(key)
+	} else {
+		v, err = s.db.RPop(key)
+	}
+
+	switch {
+	case err == database.ErrWrongType:
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "pop error"))
+		return
+	case err != nil:
+		helpers.JSONEncode(w, errors.NotFoundWrap(err, "pop error"))
+		return
+	}
+	helpers.JSONEncode(w, resource{Key: key, Value: v})
+}
+
+// ListTrim keeps only elements between start and stop query params
+func (s *httpServer) listTrim(w http.ResponseWriter, r *http.Request, key string) {
+	start, stop, err := rangeParams(r)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "invalid range"))
+		return
+	}
+	n, err := s.db.LTrim(key, start, stop)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "trim error"))
+		return
+	}
+	helpers.JSONEncode(w, listLen{Key: key, Len: n})
+}
+
+// rangeParams reads start and stop query params, defaulting to the whole list
+func rangeParams(r *http.Request) (int, int, error) {
+	q := r.URL.Query()
+	start, stop := 0, -1
+	var err error
+	if v := q.Get("start"); v != "" {
+		if start, err = strconv.Atoi(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	if v := q.Get("stop"); v != "" {
+		if stop, err = strconv.Atoi(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, stop, nil
+}
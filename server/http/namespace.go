@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// ListNamespaces returns names of all namespaces
+func (s *httpServer) listNamespaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+	helpers.JSONEncode(w, s.ns.Names())
+}
+
+// Namespace serves /ns/{name}/... from the namespace called name, the same way / is served from the default one.
+// PUT /ns/{name} creates a namespace and DELETE /ns/{name} drops it
+func (s *httpServer) namespace(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/ns/")
+	path := ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		name, path = name[:i], name[i:]
+	}
+
+	if path == "" {
+		switch r.Method {
+		case "PUT":
+			if _, err := s.ns.Create(name); err != nil {
+				helpers.JSONEncode(w, errors.BadRequestWrap(err, "create error"))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			helpers.JSONEncode(w, map[string]string{"namespace": name})
+			return
+		case "DELETE":
+			if err := s.ns.Drop(name); err != nil {
+				helpers.JSONEncode(w, errors.BadRequestWrap(err, "drop error"))
+				return
+			}
+			helpers.JSONEncode(w, map[string]bool{"dropped": true})
+			return
+		}
+		path = "/"
+	}
+
+	db, err := s.ns.Get(name)
+	if err != nil {
+		helpers.JSONEncode(w, errors.NotFoundWrap(err, "not found"))
+		return
+	}
+
+	ns := *s
+	ns.db = db
+	nsReq := r.Clone(r.Context())
+	nsReq.URL.Path = path
+	// names are safe in URLs, so the escaped path of the namespace starts with the same prefix
+	nsReq.URL.RawPath = strings.TrimPrefix(r.URL.EscapedPath(), "/ns/"+name)
+
+	ns.route(nsReq)(w, nsReq)
+}
+
+// route returns the handler of r, matching endpoints ending with a slash by prefix like http.ServeMux does.
+// Unlike http.ServeMux it never redirects, a path without the trailing slash of an endpoint is a key.
+// Paths matching no other endpoint are hash operations if they have a fields segment, see hashPath
+func (s *httpServer) route(r *http.Request) http.HandlerFunc {
+	endpoints := s.endpoints()
+	path := r.URL.Path
+	if h, ok := endpoints[path]; ok {
+		return h
+	}
+	best := "/"
+	for p := range endpoints {
+		if strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) && len(p) > len(best) {
+			best = p
+		}
+	}
+	if _, _, ok := hashPath(r.URL.EscapedPath()); ok && best == "/" {
+		return s.hash
+	}
+	return endpoints[best]
+}
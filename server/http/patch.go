@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/document"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// Patch media types
+const (
+	jsonPatch  = "application/json-patch+json"
+	mergePatch = "application/merge-patch+json"
+)
+
+// patchType returns the patch media type of the request body, or an empty string if it's not a patch
+func patchType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mt != jsonPatch && mt != mergePatch) {
+		return ""
+	}
+	return mt
+}
+
+// Patch applies a JSON Patch or JSON Merge Patch from the body to the value at /{key}
+func (s *httpServer) patch(w http.ResponseWriter, r *http.Request, mt string) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if key == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing key"))
+		return
+	}
+	if r.Header.Get("If-Match") != "" {
+		helpers.JSONEncode(w, errors.BadRequest("If-Match can't be used with patches, use a test operation instead"))
+		return
+	}
+
+	b, _ := ioutil.ReadAll(r.Body)
+	var v interface{}
+	var err error
+	if mt == jsonPatch {
+		var ops []document.Operation
+		if err := json.Unmarshal(b, &ops); err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "unmarshal error"))
+			return
+		}
+		v, err = s.db.JSONPatch(key, ops)
+	} else {
+		var p interface{}
+		if err := json.Unmarshal(b, &p); err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "unmarshal error"))
+			return
+		}
+		v, err = s.db.MergePatch(key, p)
+	}
+
+	var opErr *document.OpError
+	switch {
+	case stderrors.Is(err, document.ErrTestFailed):
+		helpers.JSONEncode(w, errors.PreconditionFailedWrap(err, "patch error"))
+		return
+	case stderrors.As(err, &opErr) || err == database.ErrWrongType:
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "patch error"))
+		return
+	case err != nil:
+		helpers.JSONEncode(w, errors.NotFoundWrap(err, "patch error"))
+		return
+	}
+	helpers.JSONEncode(w, resource{Key: key, Value: v})
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/document"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// subValue is a part of a stored value
+type subValue struct {
+	Key   string      `json:"key"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// ReadPath returns the part of the value at key selected by the path query param,
+// either a dot separated path like settings.theme or a JSON Pointer like /items/0/name
+func (s *httpServer) readPath(w http.ResponseWriter, r *http.Request, key string) {
+	path := r.URL.Query().Get("path")
+	p, err := document.ParsePath(path)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "invalid path"))
+		return
+	}
+
+	v, err := s.db.ReadPath(key, p)
+	switch {
+	case err == database.ErrWrongType:
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "path error"))
+		return
+	case err != nil:
+		helpers.JSONEncode(w, errors.NotFoundWrap(err, "not found"))
+		return
+	}
+	helpers.JSONEncode(w, subValue{Key: key, Path: path, Value: v})
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/maracko/go-store/database/query"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// queryPage is a single page of query results
+type queryPage struct {
+	Cursor  string     `json:"cursor"`
+	Results []resource `json:"results"`
+}
+
+// Query runs a query from the q param of a GET request or the body of a POST request.
+// Limit and cursor params override the clauses of the query, so pages can be fetched with the same query text
+func (s *httpServer) query(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	text := params.Get("q")
+	switch r.Method {
+	case "GET":
+	case "POST":
+		b, _ := ioutil.ReadAll(r.Body)
+		text = string(b)
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+
+	q, err := query.Parse(text)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "query error"))
+		return
+	}
+	if l := params.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit <= 0 {
+			helpers.JSONEncode(w, errors.BadRequest("limit must be a positive number"))
+			return
+		}
+	}
+	if c := params.Get("cursor"); c != "" {
+		q.Cursor = c
+	}
+
+	entries, next, err := s.db.Query(q)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "query error"))
+		return
+	}
+	page := queryPage{Cursor: next, Results: make([]resource, 0, len(entries))}
+	for _, e := range entries {
+		page.Results = append(page.Results, resource{Key: e.Key, Value: e.Value})
+	}
+	helpers.JSONEncode(w, page)
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// setCard is returned by operations changing the size of a set
+type setCard struct {
+	Key  string `json:"key"`
+	Card int    `json:"card"`
+}
+
+// member is a single member of a set
+type member struct {
+	Key    string `json:"key"`
+	Member string `json:"member"`
+}
+
+// Set handles operations on the set at key, served under /_/members/{key}: GET returns all members or their count
+// with ?card and POST adds a JSON array of members. With a member query param GET, HEAD, PUT and DELETE
+// check, add and remove one
+func (s *httpServer) set(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, typedPrefix+"members/")
+	if key == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing key"))
+		return
+	}
+	ms, ok := r.URL.Query()["member"]
+	if !ok {
+		switch r.Method {
+		case "GET":
+			s.members(w, r, key)
+		case "POST":
+			var members []string
+			b, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(b, &members); err != nil {
+				helpers.JSONEncode(w, errors.BadRequestWrap(err, "body must be a JSON array of strings"))
+				return
+			}
+			if _, err := s.db.SAdd(key, members...); err != nil {
+				helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+				return
+			}
+			s.card(w, key)
+		default:
+			helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed without a member", r.Method))
+		}
+		return
+	}
+	m := ms[0]
+
+	switch r.Method {
+	case "GET", "HEAD":
+		ok, err := s.db.SIsMember(key, m)
+		switch {
+		case err != nil:
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+		case !ok:
+			helpers.JSONEncode(w, errors.NotFound("%s is not a member of %s", m, key))
+		default:
+			helpers.JSONEncode(w, member{Key: key, Member: m})
+		}
+	case "PUT":
+		n, err := s.db.SAdd(key, m)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+			return
+		}
+		if n > 0 {
+			w.WriteHeader(http.StatusCreated)
+		}
+		helpers.JSONEncode(w, member{Key: key, Member: m})
+	case "DELETE":
+		n, err := s.db.SRem(key, m)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+			return
+		}
+		if n == 0 {
+			helpers.JSONEncode(w, errors.NotFound("%s is not a member of %s", m, key))
+			return
+		}
+		helpers.JSONEncode(w, map[string]bool{"deleted": true})
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+	}
+}
+
+// Members returns members of a set, or only their count if the card query param is present
+func (s *httpServer) members(w http.ResponseWriter, r *http.Request, key string) {
+	if _, ok := r.URL.Query()["card"]; ok {
+		s.card(w, key)
+		return
+	}
+	members, err := s.db.SMembers(key)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+		return
+	}
+	helpers.JSONEncode(w, members)
+}
+
+func (s *httpServer) card(w http.ResponseWriter, key string) {
+	n, err := s.db.SCard(key)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+		return
+	}
+	helpers.JSONEncode(w, setCard{Key: key, Card: n})
+}
+
+// SetAlgebra combines sets at the comma separated keys query param. GET /_/sets/{inter|union|diff} returns the result,
+// POST stores it in the key from the store query param
+func (s *httpServer) setAlgebra(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	op := strings.TrimPrefix(r.URL.Path, typedPrefix+"sets/")
+	keys := strings.Split(q.Get("keys"), ",")
+	if q.Get("keys") == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing keys"))
+		return
+	}
+
+	var read func(keys ...string) ([]string, error)
+	var store func(dest string, keys ...string) (int, error)
+	switch op {
+	case "inter":
+		read, store = s.db.SInter, s.db.SInterStore
+	case "union":
+		read, store = s.db.SUnion, s.db.SUnionStore
+	case "diff":
+		read, store = s.db.SDiff, s.db.SDiffStore
+	default:
+		helpers.JSONEncode(w, errors.NotFound("unknown set operation %s, use inter, union or diff", op))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		members, err := read(keys...)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+			return
+		}
+		helpers.JSONEncode(w, members)
+	case "POST":
+		dest := q.Get("store")
+		if dest == "" {
+			helpers.JSONEncode(w, errors.BadRequest("missing store key"))
+			return
+		}
+		n, err := store(dest, keys...)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+			return
+		}
+		helpers.JSONEncode(w, setCard{Key: dest, Card: n})
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+	}
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// txnOp is a single operation of a transaction
+type txnOp struct {
+	Op    string      `json:"op"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Txn runs a list of get/create/update/delete operations atomically. If any of them fails none are applied
+func (s *httpServer) txn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+
+	var ops []txnOp
+	b, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(b, &ops); err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "unmarshal error"))
+		return
+	}
+
+	resp := make([]resource, 0, len(ops))
+	err := s.db.Txn(func(tx *database.Tx) error {
+		for i, op := range ops {
+			res, err := applyTxnOp(tx, op)
+			if err != nil {
+				return fmt.Errorf("op %d (%s %s): %v", i, op.Op, op.Key, err)
+			}
+			resp = append(resp, res)
+		}
+		return nil
+	})
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "transaction aborted"))
+		return
+	}
+
+	helpers.JSONEncode(w, resp)
+}
+
+func applyTxnOp(tx *database.Tx, op txnOp) (resource, error) {
+	switch op.Op {
+	case "get":
+		val, err := tx.Read(op.Key)
+		return resource{Key: op.Key, Value: val}, err
+	case "create":
+		return resource{Key: op.Key, Value: op.Value}, tx.Create(op.Key, op.Value)
+	case "update":
+		return resource{Key: op.Key, Value: op.Value}, tx.Update(op.Key, op.Value)
+	case "delete":
+		return resource{Key: op.Key, Value: map[string]bool{"deleted": true}}, tx.Delete(op.Key)
+	}
+	return resource{}, fmt.Errorf("unknown op %q", op.Op)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// conditionFailed responds to a set with get whose condition failed, it still carries the previous value
+type conditionFailed struct {
+	Error string `json:"error"`
+	resource
+}
+
+// Put sets /{key} to the value from the body whether it exists or not. Query params change how:
+// nx only sets a missing key, xx only an existing one, keepttl keeps it's expiry and get responds with the previous value
+func (s *httpServer) put(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if key == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing key"))
+		return
+	}
+
+	var res resource
+	b, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(b, &res); err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "unmarshal error"))
+		return
+	}
+	if res.Key != "" && res.Key != key {
+		helpers.JSONEncode(w, errors.BadRequest("key %s in body doesn't match %s", res.Key, key))
+		return
+	}
+	res.Key = key
+
+	q := r.URL.Query()
+	_, nx := q["nx"]
+	_, xx := q["xx"]
+	_, keepTTL := q["keepttl"]
+	_, get := q["get"]
+	opts := database.SetOptions{
+		IfAbsent:  nx,
+		IfPresent: xx,
+		TTL:       time.Duration(res.TTL) * time.Second,
+		KeepTTL:   keepTTL,
+	}
+
+	old, existed, err := s.db.Set(key, res.Value, opts)
+	switch {
+	case err == database.ErrSetCondition && get:
+		w.WriteHeader(http.StatusPreconditionFailed)
+		helpers.JSONEncode(w, conditionFailed{Error: "set error: " + err.Error(), resource: resource{Key: key, Value: old}})
+		return
+	case err == database.ErrSetCondition:
+		helpers.JSONEncode(w, errors.PreconditionFailedWrap(err, "set error"))
+		return
+	case err != nil:
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "set error"))
+		return
+	}
+
+	if !existed {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if get {
+		helpers.JSONEncode(w, resource{Key: key, Value: old})
+		return
+	}
+	helpers.JSONEncode(w, res)
+}
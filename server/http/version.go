@@ -0,0 +1,57 @@
+package http
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// CompareAndSwap updates a key only if it's version still matches the If-Match header
+func (s *httpServer) compareAndSwap(w http.ResponseWriter, res resource, ifMatch string) {
+	expected, err := parseETag(ifMatch)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "invalid If-Match header"))
+		return
+	}
+	if res.TTL != 0 {
+		helpers.JSONEncode(w, errors.BadRequest("ttl can't be set together with If-Match"))
+		return
+	}
+
+	version, err := s.db.CompareAndSwap(res.Key, expected, res.Value)
+	switch {
+	case stderrors.Is(err, database.ErrVersionMismatch):
+		w.Header().Set("ETag", etag(version))
+		helpers.JSONEncode(w, errors.PreconditionFailedWrap(err, "update error"))
+		return
+	case stderrors.Is(err, database.ErrMissingKey):
+		helpers.JSONEncode(w, errors.NotFoundWrap(err, "update error"))
+		return
+	case err != nil:
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "update error"))
+		return
+	}
+
+	w.Header().Set("ETag", etag(version))
+	res.Version = version
+	helpers.JSONEncode(w, res)
+}
+
+func etag(version uint64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseETag reads a version from a quoted (optionally weak) entity tag
+func parseETag(tag string) (uint64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, fmt.Errorf("entity tag %s must be quoted", tag)
+	}
+	return strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// Watch streams changes of keys starting with the prefix query param as newline delimited JSON events.
+// The stream ends when the client disconnects, the server shuts down or the client falls too far behind
+func (s *httpServer) watch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		helpers.JSONEncode(w, errors.Internal("streaming not supported"))
+		return
+	}
+
+	watcher := s.db.Watch(r.URL.Query().Get("prefix"))
+	defer watcher.Close()
+
+	w.Header().Set("Content-type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				if err := watcher.Err(); err != nil {
+					_ = enc.Encode(map[string]string{"error": err.Error()})
+				}
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				log.Println("watch error:", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
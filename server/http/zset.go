@@ -0,0 +1,159 @@
+package http
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/errors"
+	"github.com/maracko/go-store/server/http/helpers"
+)
+
+// rankedMember is a member of a sorted set with it's score and rank
+type rankedMember struct {
+	Key    string  `json:"key"`
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+	Rank   int     `json:"rank"`
+}
+
+// ZSet handles operations on the sorted set at key, served under /_/scores/{key}: POST adds members from a JSON object
+// of scores and GET returns a range of them. With a member query param GET returns one with it's rank,
+// POST with ?incr=n increments it's score and DELETE removes it
+func (s *httpServer) zset(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, typedPrefix+"scores/")
+	if key == "" {
+		helpers.JSONEncode(w, errors.BadRequest("missing key"))
+		return
+	}
+	ms, ok := r.URL.Query()["member"]
+	if !ok {
+		switch r.Method {
+		case "GET":
+			s.zrange(w, r, key)
+		case "POST":
+			var scores map[string]float64
+			b, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(b, &scores); err != nil {
+				helpers.JSONEncode(w, errors.BadRequestWrap(err, "body must be a JSON object of scores"))
+				return
+			}
+			if _, err := s.db.ZAdd(key, scores); err != nil {
+				helpers.JSONEncode(w, errors.BadRequestWrap(err, "sorted set error"))
+				return
+			}
+			s.zcard(w, key)
+		default:
+			helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed without a member", r.Method))
+		}
+		return
+	}
+	m := ms[0]
+
+	switch r.Method {
+	case "GET":
+		s.zmember(w, key, m)
+	case "POST":
+		delta, err := strconv.ParseFloat(r.URL.Query().Get("incr"), 64)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequest("incr must be a number"))
+			return
+		}
+		if _, err := s.db.ZIncrBy(key, m, delta); err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "sorted set error"))
+			return
+		}
+		s.zmember(w, key, m)
+	case "DELETE":
+		n, err := s.db.ZRem(key, m)
+		if err != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(err, "sorted set error"))
+			return
+		}
+		if n == 0 {
+			helpers.JSONEncode(w, errors.NotFound("%s is not a member of %s", m, key))
+			return
+		}
+		helpers.JSONEncode(w, map[string]bool{"deleted": true})
+	default:
+		helpers.JSONEncode(w, errors.MethodNotAllowed("method %s not allowed", r.Method))
+	}
+}
+
+// Zrange returns members ranked between start and stop query params, or with scores between min and max
+// if either of them is present. With card only the number of members is returned
+func (s *httpServer) zrange(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	if _, ok := q["card"]; ok {
+		s.zcard(w, key)
+		return
+	}
+
+	var members []database.ZMember
+	var err error
+	if q.Get("min") != "" || q.Get("max") != "" {
+		min, max, limit, perr := scoreParams(r)
+		if perr != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(perr, "invalid range"))
+			return
+		}
+		members, err = s.db.ZRangeByScore(key, min, max, limit)
+	} else {
+		start, stop, perr := rangeParams(r)
+		if perr != nil {
+			helpers.JSONEncode(w, errors.BadRequestWrap(perr, "invalid range"))
+			return
+		}
+		members, err = s.db.ZRange(key, start, stop)
+	}
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "sorted set error"))
+		return
+	}
+	helpers.JSONEncode(w, members)
+}
+
+func (s *httpServer) zmember(w http.ResponseWriter, key, m string) {
+	rank, score, err := s.db.ZRank(key, m)
+	if err != nil {
+		helpers.JSONEncode(w, readError(err, "sorted set"))
+		return
+	}
+	helpers.JSONEncode(w, rankedMember{Key: key, Member: m, Score: score, Rank: rank})
+}
+
+func (s *httpServer) zcard(w http.ResponseWriter, key string) {
+	n, err := s.db.ZCard(key)
+	if err != nil {
+		helpers.JSONEncode(w, errors.BadRequestWrap(err, "sorted set error"))
+		return
+	}
+	helpers.JSONEncode(w, setCard{Key: key, Card: n})
+}
+
+// scoreParams reads min, max and limit query params. Missing bounds are infinite, -inf and +inf are accepted too
+func scoreParams(r *http.Request) (min, max float64, limit int, err error) {
+	q := r.URL.Query()
+	min, max = math.Inf(-1), math.Inf(1)
+	if v := q.Get("min"); v != "" {
+		if min, err = strconv.ParseFloat(v, 64); err != nil {
+			return
+		}
+	}
+	if v := q.Get("max"); v != "" {
+		if max, err = strconv.ParseFloat(v, 64); err != nil {
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err == nil && limit < 0 {
+			err = stderrors.New("limit must be a positive number")
+		}
+	}
+	return
+}
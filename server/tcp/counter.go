@@ -0,0 +1,48 @@
+package tcp
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+)
+
+// counter runs incr, decr, incrby, decrby and incrbyfloat
+func (s *tcpServer) counter(db *database.DB, data []string) interface{} {
+	cmd, l := strings.ToLower(data[0]), len(data)
+
+	switch {
+	case cmd == "incr" && l == 2:
+		return number(db.Incr(data[1]))
+	case cmd == "decr" && l == 2:
+		return number(db.Decr(data[1]))
+	case (cmd == "incrby" || cmd == "decrby") && l == 3:
+		delta, err := strconv.ParseInt(data[2], 10, 64)
+		if err != nil {
+			return "increment must be an integer"
+		}
+		if cmd == "decrby" {
+			return number(db.DecrBy(data[1], delta))
+		}
+		return number(db.IncrBy(data[1], delta))
+	case cmd == "incrbyfloat" && l == 3:
+		delta, err := strconv.ParseFloat(data[2], 64)
+		if err != nil {
+			return "increment must be a number"
+		}
+		f, err := db.IncrByFloat(data[1], delta)
+		if err != nil {
+			return err
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	return "usage: [incr|decr key] [incrby|decrby key n] [incrbyfloat key n]"
+}
+
+func number(n int64, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return n
+}
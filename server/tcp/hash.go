@@ -0,0 +1,72 @@
+package tcp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+)
+
+// hash runs h* commands on the hash at data[1]
+func (s *tcpServer) hash(db *database.DB, data []string) interface{} {
+	cmd, key, l := strings.ToLower(data[0]), data[1], len(data)
+
+	switch {
+	case cmd == "hset" && l == 4:
+		created, err := db.HSet(key, data[2], data[3])
+		if err != nil {
+			return err
+		}
+		if created {
+			return fmt.Sprintf("created field %v of %v", data[2], key)
+		}
+		return fmt.Sprintf("updated field %v of %v", data[2], key)
+	case cmd == "hget" && l == 3:
+		v, err := db.HGet(key, data[2])
+		if err != nil {
+			return err
+		}
+		return v
+	case cmd == "hdel" && l >= 3:
+		n, err := db.HDel(key, data[2:]...)
+		if err != nil {
+			return err
+		}
+		return n
+	case cmd == "hgetall" && l == 2:
+		fields, err := db.HGetAll(key)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(fields))
+		for f := range fields {
+			names = append(names, f)
+		}
+		sort.Strings(names)
+		res := make([]string, 0, len(fields)*2)
+		for _, f := range names {
+			res = append(res, f, fmt.Sprint(fields[f]))
+		}
+		return strings.Join(res, " ")
+	case cmd == "hexists" && l == 3:
+		ok, err := db.HExists(key, data[2])
+		if err != nil {
+			return err
+		}
+		return ok
+	case cmd == "hincrby" && l == 4:
+		delta, err := strconv.ParseInt(data[3], 10, 64)
+		if err != nil {
+			return "increment must be an integer"
+		}
+		n, err := db.HIncrBy(key, data[2], delta)
+		if err != nil {
+			return err
+		}
+		return n
+	}
+
+	return "usage: [hset key field value] [hget|hexists key field] [hdel key field...] [hgetall key] [hincrby key field n]"
+}
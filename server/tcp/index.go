@@ -0,0 +1,96 @@
+package tcp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/document"
+)
+
+// index lists, creates or drops secondary indexes. Args are [index], [index list], [index create name prefix [path]]
+// or [index drop name]. Without a path whole values are indexed
+func (s *tcpServer) index(db *database.DB, data []string) interface{} {
+	usage := "usage: [index] [list|create name prefix [path]|drop name]"
+	l := len(data)
+	switch {
+	case l == 1 || strings.ToLower(data[1]) == "list" && l == 2:
+		idx := db.Indexes()
+		defs := make([]string, 0, len(idx))
+		for _, x := range idx {
+			defs = append(defs, fmt.Sprintf("%s:%s:%s", x.Name, x.Prefix, x.Path))
+		}
+		return strings.Join(defs, " ")
+	case strings.ToLower(data[1]) == "create" && (l == 4 || l == 5):
+		path := ""
+		if l == 5 {
+			path = unquoteEmpty(data[4])
+		}
+		if err := db.CreateIndex(data[2], unquoteEmpty(data[3]), path); err != nil {
+			return err
+		}
+		return fmt.Sprintf("created index %v", data[2])
+	case strings.ToLower(data[1]) == "drop" && l == 3:
+		if err := db.DropIndex(data[2]); err != nil {
+			return err
+		}
+		return fmt.Sprintf("dropped index %v", data[2])
+	}
+	return usage
+}
+
+// find looks up keys in an index, split by spaces. Args are [find name value] or [range name min max],
+// both optionally followed by [limit n]. Values are parsed as JSON, - and + leave a range open
+func (s *tcpServer) find(db *database.DB, data []string) interface{} {
+	cmd, l := strings.ToLower(data[0]), len(data)
+	usage := "usage: [find name value] [range name min max] [limit n]"
+	args := 3
+	if cmd == "range" {
+		args = 4
+	}
+
+	limit := 0
+	switch {
+	case l == args+2 && strings.ToLower(data[args]) == "limit":
+		n, err := strconv.Atoi(data[args+1])
+		if err != nil || n < 0 {
+			return "limit must be a positive number"
+		}
+		limit = n
+	case l != args:
+		return usage
+	}
+
+	var entries []database.Entry
+	var err error
+	if cmd == "find" {
+		entries, err = db.Find(data[1], document.ParseValue(data[2]), limit)
+	} else {
+		entries, err = db.FindRange(data[1], bound(data[2]), bound(data[3]), limit)
+	}
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return strings.Join(keys, " ")
+}
+
+// bound parses a range bound, - and + stand for an open range
+func bound(s string) interface{} {
+	if s == "-" || s == "+" {
+		return nil
+	}
+	return document.ParseValue(s)
+}
+
+// unquoteEmpty returns "" for an argument typed as "", which is otherwise impossible to pass
+func unquoteEmpty(s string) string {
+	if s == `""` {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package tcp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maracko/go-store/database"
+)
+
+// push pushes values to either end of the list at key and returns it's new length
+func (s *tcpServer) push(db *database.DB, left bool, key string, values []string) interface{} {
+	vals := make([]interface{}, len(values))
+	for i, v := range values {
+		vals[i] = v
+	}
+	push := db.RPush
+	if left {
+		push = db.LPush
+	}
+	n, err := push(key, vals...)
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+// pop pops from either end of the list at key
+func (s *tcpServer) pop(db *database.DB, key string, left bool) interface{} {
+	pop := db.RPop
+	if left {
+		pop = db.LPop
+	}
+	v, err := pop(key)
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+// blockingPop pops from either end of the list at key, waiting up to timeout seconds for an element.
+// The connection isn't read while waiting, so a client which disconnects can't end the wait and it must be limited
+func (s *tcpServer) blockingPop(db *database.DB, key, timeout string, left bool) interface{} {
+	secs, err := strconv.Atoi(timeout)
+	if err != nil || secs <= 0 {
+		return "timeout must be a positive number of seconds"
+	}
+	pop := db.BRPop
+	if left {
+		pop = db.BLPop
+	}
+	v, err := pop(s.ctx, key, time.Duration(secs)*time.Second)
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+// listRange returns elements of the list at key between start and stop split by spaces,
+// or trims the list to them and returns it's new length
+func (s *tcpServer) listRange(db *database.DB, trim bool, key, start, stop string) interface{} {
+	from, err := strconv.Atoi(start)
+	if err != nil {
+		return "start must be a number"
+	}
+	to, err := strconv.Atoi(stop)
+	if err != nil {
+		return "stop must be a number"
+	}
+
+	if trim {
+		n, err := db.LTrim(key, from, to)
+		if err != nil {
+			return err
+		}
+		return n
+	}
+	items, err := db.LRange(key, from, to)
+	if err != nil {
+		return err
+	}
+	res := make([]string, len(items))
+	for i, v := range items {
+		res[i] = fmt.Sprint(v)
+	}
+	return strings.Join(res, " ")
+}
@@ -0,0 +1,28 @@
+package tcp
+
+import (
+	"encoding/json"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/document"
+)
+
+// getPath returns the part of the value at key which path points to, encoded as JSON unless it's a string
+func (s *tcpServer) getPath(db *database.DB, key, path string) interface{} {
+	p, err := document.ParsePath(path)
+	if err != nil {
+		return err
+	}
+	v, err := db.ReadPath(key, p)
+	if err != nil {
+		return err
+	}
+	if str, ok := v.(string); ok {
+		return str
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return string(b)
+}
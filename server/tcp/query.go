@@ -0,0 +1,34 @@
+package tcp
+
+import (
+	"encoding/json"
+
+	"github.com/maracko/go-store/database"
+	"github.com/maracko/go-store/database/query"
+)
+
+// query runs a query and returns the next cursor followed by results as a JSON array of key and value objects
+func (s *tcpServer) query(db *database.DB, text string) interface{} {
+	q, err := query.Parse(text)
+	if err != nil {
+		return err
+	}
+	entries, next, err := db.Query(q)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	}
+	results := make([]result, 0, len(entries))
+	for _, e := range entries {
+		results = append(results, result{e.Key, e.Value})
+	}
+	b, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	return next + " " + string(b)
+}
@@ -0,0 +1,57 @@
+package tcp
+
+import (
+	"strings"
+
+	"github.com/maracko/go-store/database"
+)
+
+// set runs s* commands, members are returned split by spaces
+func (s *tcpServer) set(db *database.DB, data []string) interface{} {
+	cmd, l := strings.ToLower(data[0]), len(data)
+
+	switch {
+	case cmd == "sadd" && l >= 3:
+		return count(db.SAdd(data[1], data[2:]...))
+	case cmd == "srem" && l >= 3:
+		return count(db.SRem(data[1], data[2:]...))
+	case cmd == "sismember" && l == 3:
+		ok, err := db.SIsMember(data[1], data[2])
+		if err != nil {
+			return err
+		}
+		return ok
+	case cmd == "smembers" && l == 2:
+		return members(db.SMembers(data[1]))
+	case cmd == "scard" && l == 2:
+		return count(db.SCard(data[1]))
+	case cmd == "sinter":
+		return members(db.SInter(data[1:]...))
+	case cmd == "sunion":
+		return members(db.SUnion(data[1:]...))
+	case cmd == "sdiff":
+		return members(db.SDiff(data[1:]...))
+	case cmd == "sinterstore" && l >= 3:
+		return count(db.SInterStore(data[1], data[2:]...))
+	case cmd == "sunionstore" && l >= 3:
+		return count(db.SUnionStore(data[1], data[2:]...))
+	case cmd == "sdiffstore" && l >= 3:
+		return count(db.SDiffStore(data[1], data[2:]...))
+	}
+
+	return "usage: [sadd|srem key member...] [sismember key member] [smembers|scard key] [sinter|sunion|sdiff key...] [sinterstore|sunionstore|sdiffstore dest key...]"
+}
+
+func count(n int, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+func members(m []string, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return strings.Join(m, " ")
+}
@@ -2,38 +2,46 @@ package tcp
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/maracko/go-store/database"
 	"github.com/maracko/go-store/server"
 )
 
 // New create new server
-func New(port int, db *database.DB) server.Server {
+func New(port int, ns *database.Registry) server.Server {
 	s := &tcpServer{
 		port: port,
-		db:   db,
+		ns:   ns,
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
-	if err := s.db.Connect(); err != nil {
+	if err := s.ns.Connect(); err != nil {
 		log.Fatalln(err)
 	}
 
 	return s
 }
 
-// Server is a struct with host info and a database instance
+// Server is a struct with host info and the namespaces it serves
 type tcpServer struct {
 	port int
-	db   *database.DB
+	ns   *database.Registry
+	// ctx is cancelled by Clean, ending commands still waiting like blocking pops
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // Clean cleans a server
 func (s *tcpServer) Clean() error {
-	return s.db.Disconnect()
+	s.cancel()
+	return s.ns.Disconnect()
 }
 
 // Serve starts a TCP server
@@ -60,9 +68,18 @@ func (s *tcpServer) handle(conn net.Conn) {
 	scanner := bufio.NewScanner(conn)
 	defer conn.Close()
 
+	sess := &session{ns: database.DefaultNamespace}
 	for scanner.Scan() {
 		ln := scanner.Text()
-		resp := s.command(ln)
+		if prefix, ok := watchCommand(ln); ok && !sess.multi {
+			if db, err := s.ns.Get(sess.ns); err != nil {
+				fmt.Fprintln(conn, err)
+			} else {
+				s.watch(db, conn, scanner, prefix)
+			}
+			continue
+		}
+		resp := s.command(sess, ln)
 		log.Printf("Host: %v Command: %v Response: %v", conn.RemoteAddr(), ln, resp)
 		fmt.Fprintln(conn, resp)
 	}
@@ -70,42 +87,256 @@ func (s *tcpServer) handle(conn net.Conn) {
 	log.Printf("Connection from %v closed\n", conn.RemoteAddr())
 }
 
-func (s *tcpServer) command(input string) interface{} {
+func (s *tcpServer) command(sess *session, input string) interface{} {
 	e := "Invalid command"
 	data := strings.Split(input, " ")
 	l := len(data)
 
+	if sess.multi {
+		return s.queue(sess, input)
+	}
+	if l == 2 && strings.ToLower(data[0]) == "select" {
+		if _, err := s.ns.Get(data[1]); err != nil {
+			return err
+		}
+		sess.ns = data[1]
+		return fmt.Sprintf("using %v", data[1])
+	}
+	if strings.ToLower(data[0]) == "ns" {
+		return s.namespace(data[1:])
+	}
+
+	// Resolved on every command so a dropped namespace is never written to
+	db, err := s.ns.Get(sess.ns)
+	if err != nil {
+		return err
+	}
+
+	if l == 1 {
+		switch strings.ToLower(data[0]) {
+		case "multi":
+			sess.multi = true
+			return "transaction started"
+		case "exec", "discard":
+			return "no transaction in progress"
+		case "rewrite":
+			if err := db.BackgroundRewriteLog(); err != nil {
+				return err
+			}
+			return "log rewrite started"
+		case "scan":
+			return s.scan(db, "", 0)
+		case "index":
+			return s.index(db, data)
+		case "query":
+			return s.query(db, "")
+		case "memory":
+			m := db.MemoryStats()
+			return fmt.Sprintf("used %d max %d policy %s keys %d evicted %d rejected %d", m.UsedMemory, m.MaxMemory, m.Policy, m.Keys, m.Evicted, m.Rejected)
+		}
+	}
+
 	if l < 2 {
 		return e
 	}
 
 	switch strings.ToLower(data[0]) {
+	case "select":
+		return "usage: [select] [namespace]"
 	case "get":
-		res, _ := s.db.Read(data[1])
+		res, _ := db.Read(data[1])
 		return res
 	case "set":
 		if l == 3 {
-			err := s.db.Create(data[1], data[2])
+			err := db.Create(data[1], data[2])
 			if err != nil {
 				return err
 			}
 			return fmt.Sprintf("created %v", data[1])
 		}
-		return "usage: [set] [key] [value]"
+		if l > 3 {
+			return s.upsert(db, data[1], data[2], data[3:])
+		}
+		return "usage: [set] [key] [value] [nx|xx] [get] [ex seconds|keepttl]"
 	case "upd":
 		if l == 3 {
-			if err := s.db.Update(data[1], data[2]); err != nil {
+			if err := db.Update(data[1], data[2]); err != nil {
 				return err
 			}
 			return fmt.Sprintf("updated %v", data[1])
 		}
 		return "usage: [update] [key] [value]"
 	case "del":
-		if err := s.db.Delete(data[1]); err != nil {
+		if err := db.Delete(data[1]); err != nil {
 			return err
 		}
 		return fmt.Sprintf("deleted %v", data[1])
+	case "expire":
+		if l == 3 {
+			secs, err := strconv.Atoi(data[2])
+			if err != nil || secs <= 0 {
+				return "ttl must be a positive number of seconds"
+			}
+			if err := db.Expire(data[1], time.Duration(secs)*time.Second); err != nil {
+				return err
+			}
+			return fmt.Sprintf("%v expires in %vs", data[1], secs)
+		}
+		return "usage: [expire] [key] [seconds]"
+	case "ttl":
+		ttl, err := db.TTL(data[1])
+		if err != nil {
+			return err
+		}
+		if ttl == database.NoExpiry {
+			return -1
+		}
+		return int64(ttl.Round(time.Second) / time.Second)
+	case "scan":
+		if l == 2 {
+			return s.scan(db, data[1], 0)
+		}
+		if l == 3 {
+			limit, err := strconv.Atoi(data[2])
+			if err != nil || limit < 0 {
+				return "limit must be a positive number"
+			}
+			return s.scan(db, data[1], limit)
+		}
+		return "usage: [scan] [prefix] [limit]"
+	case "cursor":
+		return s.scanCursor(db, data[1:])
+	case "getpath":
+		if l == 3 {
+			return s.getPath(db, data[1], data[2])
+		}
+		return "usage: [getpath] [key] [path]"
+	case "gets":
+		res, version, err := db.ReadWithVersion(data[1])
+		if err != nil {
+			return err
+		}
+		return fmt.Sprintf("%d %v", version, res)
+	case "cas":
+		if l == 4 {
+			expected, err := strconv.ParseUint(data[2], 10, 64)
+			if err != nil {
+				return "version must be a positive number"
+			}
+			version, err := db.CompareAndSwap(data[1], expected, data[3])
+			if err != nil {
+				return err
+			}
+			return fmt.Sprintf("swapped %v, version %d", data[1], version)
+		}
+		return "usage: [cas] [key] [version] [value]"
+	case "lpush", "rpush":
+		if l >= 3 {
+			return s.push(db, strings.ToLower(data[0]) == "lpush", data[1], data[2:])
+		}
+		return "usage: [lpush|rpush] [key] [value] [value...]"
+	case "lpop":
+		return s.pop(db, data[1], true)
+	case "rpop":
+		return s.pop(db, data[1], false)
+	case "blpop", "brpop":
+		if l == 3 {
+			return s.blockingPop(db, data[1], data[2], strings.ToLower(data[0]) == "blpop")
+		}
+		return "usage: [blpop|brpop] [key] [timeout seconds]"
+	case "llen":
+		n, err := db.LLen(data[1])
+		if err != nil {
+			return err
+		}
+		return n
+	case "lrange", "ltrim":
+		if l == 4 {
+			return s.listRange(db, strings.ToLower(data[0]) == "ltrim", data[1], data[2], data[3])
+		}
+		return "usage: [lrange|ltrim] [key] [start] [stop]"
+	case "hset", "hget", "hdel", "hgetall", "hexists", "hincrby":
+		return s.hash(db, data)
+	case "sadd", "srem", "sismember", "smembers", "scard", "sinter", "sunion", "sdiff", "sinterstore", "sunionstore", "sdiffstore":
+		return s.set(db, data)
+	case "zadd", "zincrby", "zrem", "zrange", "zrangebyscore", "zrank", "zcard":
+		return s.zset(db, data)
+	case "incr", "decr", "incrby", "decrby", "incrbyfloat":
+		return s.counter(db, data)
+	case "index":
+		return s.index(db, data)
+	case "find", "range":
+		return s.find(db, data)
+	case "query":
+		// the query is taken as typed, so spaces inside strings are kept
+		return s.query(db, input[len(data[0]):])
+	case "persist":
+		if err := db.Persist(data[1]); err != nil {
+			return err
+		}
+		return fmt.Sprintf("persisted %v", data[1])
 	}
 
 	return nil
 }
+
+// scan returns keys starting with prefix in lexicographic order, split by spaces
+func (s *tcpServer) scan(db *database.DB, prefix string, limit int) string {
+	entries := db.Scan(prefix, "", "", limit)
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return strings.Join(keys, " ")
+}
+
+// scanCursor returns the next cursor followed by a page of keys, split by spaces.
+// Args are [cursor] [match pattern] [count n]
+func (s *tcpServer) scanCursor(db *database.DB, args []string) string {
+	usage := "usage: [cursor] [cursor] [match pattern] [count n]"
+	match := ""
+	count := 0
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return usage
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			match = args[i+1]
+		case "count":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return "count must be a positive number"
+			}
+			count = n
+		default:
+			return usage
+		}
+	}
+
+	keys, next, err := db.ScanCursor(args[0], match, count)
+	if err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(next + " " + strings.Join(keys, " "))
+}
+
+// namespace lists, creates or drops namespaces. Args are [], [list], [create name] or [drop name]
+func (s *tcpServer) namespace(args []string) interface{} {
+	usage := "usage: [ns] [list|create|drop] [namespace]"
+	switch {
+	case len(args) == 0 || strings.ToLower(args[0]) == "list" && len(args) == 1:
+		return strings.Join(s.ns.Names(), " ")
+	case strings.ToLower(args[0]) == "create" && len(args) == 2:
+		if _, err := s.ns.Create(args[1]); err != nil {
+			return err
+		}
+		return fmt.Sprintf("created namespace %v", args[1])
+	case strings.ToLower(args[0]) == "drop" && len(args) == 2:
+		if err := s.ns.Drop(args[1]); err != nil {
+			return err
+		}
+		return fmt.Sprintf("dropped namespace %v", args[1])
+	}
+	return usage
+}
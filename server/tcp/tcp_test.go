@@ -0,0 +1,269 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maracko/go-store/database"
+)
+
+// newTestServer returns a server over in-memory databases and a session using the default namespace
+func newTestServer(t *testing.T) (*tcpServer, *session) {
+	t.Helper()
+	reg := database.NewRegistry("", func(l string) *database.DB {
+		return database.New(l, true, false, make(chan error, 10), make(chan bool), 0)
+	})
+	s := New(0, reg).(*tcpServer)
+	t.Cleanup(func() { _ = s.Clean() })
+	return s, &session{ns: database.DefaultNamespace}
+}
+
+// expect runs each command and checks it's response as printed to the client
+func expect(t *testing.T, s *tcpServer, sess *session, commands ...string) {
+	t.Helper()
+	for i := 0; i+1 < len(commands); i += 2 {
+		if res := fmt.Sprint(s.command(sess, commands[i])); res != commands[i+1] {
+			t.Errorf("%s: expected %q, got %q", commands[i], commands[i+1], res)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"rpush l b c", "2",
+		"lpush l a z", "4",
+		"lrange l 0 -1", "z a b c",
+		"llen l", "4",
+		"lpop l", "z",
+		"rpop l", "c",
+		"ltrim l 1 1", "1",
+		"lrange l 0 x", "stop must be a number",
+		"blpop l 1", "b",
+		"blpop l 1", database.ErrPopTimeout.Error(),
+		"brpop l x", "timeout must be a positive number of seconds",
+		"brpop l 0", "timeout must be a positive number of seconds",
+		"lpop l", "l doesn't exist",
+		"llen l", "0",
+		"rpush l", "usage: [lpush|rpush] [key] [value] [value...]",
+		"set plain x", "created plain",
+		"rpush plain a", database.ErrWrongType.Error(),
+	)
+}
+
+func TestBlockingPopEndsOnClean(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	res := make(chan interface{})
+	go func() { res <- s.command(sess, "blpop l 60") }()
+	time.Sleep(50 * time.Millisecond)
+	if err := s.Clean(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-res:
+		if v != context.Canceled {
+			t.Errorf("expected %v, got %v", context.Canceled, v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking pop still waits after Clean")
+	}
+}
+
+func TestHash(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"hset user name ana", "created field name of user",
+		"hset user name eva", "updated field name of user",
+		"hset user age 30", "created field age of user",
+		"hget user name", "eva",
+		"hgetall user", "age 30 name eva",
+		"hexists user age", "true",
+		"hincrby user visits 2", "2",
+		"hincrby user visits x", "increment must be an integer",
+		"hdel user age missing", "1",
+		"hexists user age", "false",
+		"hget user age", "field age of user doesn't exist",
+		"hget user", "usage: [hset key field value] [hget|hexists key field] [hdel key field...] [hgetall key] [hincrby key field n]",
+		"set plain x", "created plain",
+		"hset plain a b", database.ErrWrongType.Error(),
+	)
+}
+
+func TestSet(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"sadd a x y z", "3",
+		"sadd a x", "0",
+		"sadd b y z w", "3",
+		"sismember a x", "true",
+		"scard a", "3",
+		"smembers a", "x y z",
+		"sinter a b", "y z",
+		"sunion a b", "w x y z",
+		"sdiff a b", "x",
+		"sinterstore c a b", "2",
+		"smembers c", "y z",
+		"sunionstore c a b", "4",
+		"sdiffstore c a b", "1",
+		"smembers c", "x",
+		"srem a x missing", "1",
+		"sismember a x", "false",
+		"smembers missing", "",
+		"sadd a", "usage: [sadd|srem key member...] [sismember key member] [smembers|scard key] [sinter|sunion|sdiff key...] [sinterstore|sunionstore|sdiffstore dest key...]",
+		"set plain x", "created plain",
+		"sadd plain a", database.ErrWrongType.Error(),
+		"sinter a plain", database.ErrWrongType.Error(),
+	)
+}
+
+func TestZSet(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"zadd board 3 ana 1.5 ivo", "2",
+		"zadd board 5 eva", "1",
+		"zincrby board 2 ivo", "3.5",
+		"zincrby board x ivo", "increment must be a number",
+		"zrange board 0 -1", "ana 3 ivo 3.5 eva 5",
+		"zrange board 0 x", "start and stop must be numbers",
+		"zrangebyscore board 3.5 +inf", "ivo 3.5 eva 5",
+		"zrangebyscore board -inf +inf limit 1", "ana 3",
+		"zrangebyscore board x 1", "min and max must be numbers, -inf or +inf",
+		"zrangebyscore board 1 2 max 1", "usage: [zrangebyscore] [key] [min] [max] [limit n]",
+		"zrank board eva", "2",
+		"zrank board bob", "bob is not a member of board",
+		"zrem board ana bob", "1",
+		"zcard board", "2",
+		"zadd board 1", "usage: [zadd key score member...] [zincrby key n member] [zrem key member...] [zrange key start stop] [zrangebyscore key min max [limit n]] [zrank key member] [zcard key]",
+		"zadd board x bob", "score must be a number",
+		"set plain x", "created plain",
+		"zadd plain 1 a", database.ErrWrongType.Error(),
+	)
+}
+
+func TestCounter(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"incr hits", "1",
+		"incrby hits 5", "6",
+		"decrby hits 2", "4",
+		"decr hits", "3",
+		"incrby hits x", "increment must be an integer",
+		"incrbyfloat price 0.5", "0.5",
+		"incrbyfloat price x", "increment must be a number",
+		"incr hits 1", "usage: [incr|decr key] [incrby|decrby key n] [incrbyfloat key n]",
+		"set plain x", "created plain",
+		"incr plain", "plain: value is not an integer",
+	)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"set a x", "created a",
+		"gets a", "1 x",
+		"cas a 1 y", "swapped a, version 2",
+		"cas a 1 z", "version mismatch: a is at version 2, expected 1",
+		"gets a", "2 y",
+		"cas b 1 z", "key doesn't exist: b",
+		"cas b 0 z", "swapped b, version 3",
+		"cas a x z", "version must be a positive number",
+		"cas a 2", "usage: [cas] [key] [version] [value]",
+	)
+}
+
+func TestUpsert(t *testing.T) {
+	s, sess := newTestServer(t)
+
+	expect(t, s, sess,
+		"set a 1 ex 100", "set a",
+		"set a 2 keepttl", "set a",
+		"ttl a", "100",
+		"set a 3 get", "2",
+		"set a 4 nx get", "3",
+		"set a 4 nx", database.ErrSetCondition.Error(),
+		"set b 4 xx", database.ErrSetCondition.Error(),
+		"set b 4 nx get", "<nil>",
+		"get a", "3",
+		"get b", "4",
+		"set a 5 ex", "ex needs a number of seconds",
+		"set a 5 ex 0", "ttl must be a positive number of seconds",
+		"set a 5 px 10", "unknown flag px, use nx, xx, get, ex or keepttl",
+	)
+}
+
+func TestGetPath(t *testing.T) {
+	s, sess := newTestServer(t)
+	db, _ := s.ns.Get(sess.ns)
+	_ = db.Create("doc", map[string]interface{}{"a": map[string]interface{}{"b/c": []interface{}{1.0, "x"}}})
+
+	expect(t, s, sess,
+		"getpath doc /a/b~1c/1", "x",
+		"getpath doc a", `{"b/c":[1,"x"]}`,
+		"getpath doc /a/b~1c/0", "1",
+		"getpath doc a.d", "/a/d doesn't exist",
+		"getpath doc /a/~2", `invalid pointer "/a/~2", ~ must be followed by 0 or 1`,
+		"getpath missing a", "missing doesn't exist",
+		"getpath doc", "usage: [getpath] [key] [path]",
+	)
+}
+
+func TestIndex(t *testing.T) {
+	s, sess := newTestServer(t)
+	db, _ := s.ns.Get(sess.ns)
+	_ = db.Create("user:1", map[string]interface{}{"age": 30.0})
+	_ = db.Create("user:2", map[string]interface{}{"age": 25.0})
+	_ = db.Create("tag:1", "go")
+
+	expect(t, s, sess,
+		"index create age user: age", "created index age",
+		"index create tags tag:", "created index tags",
+		"index create all \"\"", "created index all",
+		"index create age user: age", "index age already exists",
+		"index", "age:user::age all:: tags:tag::",
+		"find age 30", "user:1",
+		"find tags go", "tag:1",
+		"range age - +", "user:2 user:1",
+		"range age 26 +", "user:1",
+		"range age - + limit 1", "user:2",
+		"range age - + limit x", "limit must be a positive number",
+		"find age [1]", database.ErrNotIndexable.Error(),
+		"find age", "usage: [find name value] [range name min max] [limit n]",
+		"find name ana", "index name doesn't exist",
+		"index drop age", "dropped index age",
+		"index drop age", "index age doesn't exist",
+		"index create", "usage: [index] [list|create name prefix [path]|drop name]",
+	)
+}
+
+func TestQuery(t *testing.T) {
+	s, sess := newTestServer(t)
+	db, _ := s.ns.Get(sess.ns)
+	_ = db.Create("order:1", map[string]interface{}{"total": 50.0, "name": "ana"})
+	_ = db.Create("order:2", map[string]interface{}{"total": 150.0, "name": "ivo"})
+	_ = db.Create("order:3", map[string]interface{}{"total": 250.0, "name": "eva ana"})
+
+	expect(t, s, sess,
+		"query from order:* where total > 100 select name", `0 [{"key":"order:2","value":{"name":"ivo"}},{"key":"order:3","value":{"name":"eva ana"}}]`,
+		`query where name == "eva ana"`, `0 [{"key":"order:3","value":{"name":"eva ana","total":250}}]`,
+		"query where total > 1000", "0 []",
+		"query where total >", "expected a field or value instead of end of query",
+		"query", `0 [{"key":"order:1","value":{"name":"ana","total":50}},{"key":"order:2","value":{"name":"ivo","total":150}},{"key":"order:3","value":{"name":"eva ana","total":250}}]`,
+	)
+
+	res := fmt.Sprint(s.command(sess, "query from order:* limit 2"))
+	cursor := strings.SplitN(res, " ", 2)[0]
+	if cursor == "0" {
+		t.Fatalf("expected a cursor for the next page, got %s", res)
+	}
+	expect(t, s, sess, "query from order:* limit 2 cursor "+cursor, `0 [{"key":"order:3","value":{"name":"eva ana","total":250}}]`)
+}
@@ -0,0 +1,83 @@
+package tcp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+)
+
+// session holds the state of a single client connection
+type session struct {
+	// ns is the namespace commands run against, changed with SELECT
+	ns string
+	// multi is set between MULTI and EXEC or DISCARD, while commands are queued instead of executed
+	multi bool
+	queue []string
+}
+
+// queue adds a command to the transaction or ends it on EXEC and DISCARD
+func (s *tcpServer) queue(sess *session, input string) interface{} {
+	data := strings.Split(input, " ")
+
+	switch strings.ToLower(data[0]) {
+	case "exec":
+		defer sess.reset()
+		db, err := s.ns.Get(sess.ns)
+		if err != nil {
+			return "transaction aborted, " + err.Error()
+		}
+		return s.exec(db, sess.queue)
+	case "discard":
+		n := len(sess.queue)
+		sess.reset()
+		return fmt.Sprintf("discarded %d commands", n)
+	case "multi":
+		return "transaction already in progress"
+	case "get", "set", "upd", "del":
+		sess.queue = append(sess.queue, input)
+		return "queued"
+	}
+	return "only get, set, upd and del can be used in a transaction"
+}
+
+// exec runs queued commands atomically and returns their results split by "; ".
+// If any of them fails none are applied
+func (s *tcpServer) exec(db *database.DB, cmds []string) interface{} {
+	results := make([]string, 0, len(cmds))
+	err := db.Txn(func(tx *database.Tx) error {
+		for _, cmd := range cmds {
+			res, err := execTxCommand(tx, strings.Split(cmd, " "))
+			if err != nil {
+				return fmt.Errorf("%s: %v", cmd, err)
+			}
+			results = append(results, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return "transaction aborted, " + err.Error()
+	}
+	return strings.Join(results, "; ")
+}
+
+func execTxCommand(tx *database.Tx, data []string) (string, error) {
+	name := strings.ToLower(data[0])
+	switch {
+	case name == "get" && len(data) == 2:
+		res, err := tx.Read(data[1])
+		return fmt.Sprint(res), err
+	case name == "set" && len(data) == 3:
+		return fmt.Sprintf("created %v", data[1]), tx.Create(data[1], data[2])
+	case name == "upd" && len(data) == 3:
+		return fmt.Sprintf("updated %v", data[1]), tx.Update(data[1], data[2])
+	case name == "del" && len(data) == 2:
+		return fmt.Sprintf("deleted %v", data[1]), tx.Delete(data[1])
+	}
+	return "", fmt.Errorf("wrong number of arguments")
+}
+
+func (sess *session) reset() {
+	sess.multi = false
+	sess.queue = nil
+}
@@ -0,0 +1,51 @@
+package tcp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maracko/go-store/database"
+)
+
+// upsert stores value under key whether it exists or not, changed by flags nx, xx, get, ex seconds and keepttl
+func (s *tcpServer) upsert(db *database.DB, key, value string, flags []string) interface{} {
+	var opts database.SetOptions
+	get := false
+	for i := 0; i < len(flags); i++ {
+		switch strings.ToLower(flags[i]) {
+		case "nx":
+			opts.IfAbsent = true
+		case "xx":
+			opts.IfPresent = true
+		case "get":
+			get = true
+		case "keepttl":
+			opts.KeepTTL = true
+		case "ex":
+			if i+1 == len(flags) {
+				return "ex needs a number of seconds"
+			}
+			i++
+			secs, err := strconv.Atoi(flags[i])
+			if err != nil || secs <= 0 {
+				return "ttl must be a positive number of seconds"
+			}
+			opts.TTL = time.Duration(secs) * time.Second
+		default:
+			return fmt.Sprintf("unknown flag %v, use nx, xx, get, ex or keepttl", flags[i])
+		}
+	}
+
+	old, _, err := db.Set(key, value, opts)
+	switch {
+	case err == database.ErrSetCondition && get:
+		return old
+	case err != nil:
+		return err
+	case get:
+		return old
+	}
+	return fmt.Sprintf("set %v", key)
+}
@@ -0,0 +1,62 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+)
+
+// watchCommand reports whether input is a watch command and returns it's prefix
+func watchCommand(input string) (string, bool) {
+	data := strings.Split(input, " ")
+	if strings.ToLower(data[0]) != "watch" || len(data) > 2 {
+		return "", false
+	}
+	if len(data) == 2 {
+		return data[1], true
+	}
+	return "", true
+}
+
+// watchEnd is the line sent once a watch is over and the connection accepts commands again
+const watchEnd = "stopped watching"
+
+// watch pushes changes of keys starting with prefix to conn as JSON lines, until the client sends any line or disconnects
+func (s *tcpServer) watch(db *database.DB, conn net.Conn, scanner *bufio.Scanner, prefix string) {
+	watcher := db.Watch(prefix)
+	defer watcher.Close()
+	log.Printf("Host: %v watching %q", conn.RemoteAddr(), prefix)
+	fmt.Fprintf(conn, "watching %q, send any line to stop\n", prefix)
+
+	// The scanner is only read by this goroutine until it delivers, so the connection loop can safely continue after
+	stop := make(chan struct{})
+	go func() {
+		scanner.Scan()
+		close(stop)
+	}()
+
+	defer fmt.Fprintln(conn, watchEnd)
+
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case <-stop:
+			return
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				fmt.Fprintf(conn, "watch closed: %v, send any line to continue\n", watcher.Err())
+				<-stop
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				<-stop
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tcp
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/maracko/go-store/database"
+)
+
+// zset runs z* commands, members are returned as members followed by their scores split by spaces
+func (s *tcpServer) zset(db *database.DB, data []string) interface{} {
+	cmd, l := strings.ToLower(data[0]), len(data)
+
+	switch {
+	case cmd == "zadd" && l >= 4 && l%2 == 0:
+		scores := make(map[string]float64, (l-2)/2)
+		for i := 2; i < l; i += 2 {
+			score, err := strconv.ParseFloat(data[i], 64)
+			if err != nil {
+				return "score must be a number"
+			}
+			scores[data[i+1]] = score
+		}
+		return count(db.ZAdd(data[1], scores))
+	case cmd == "zincrby" && l == 4:
+		delta, err := strconv.ParseFloat(data[2], 64)
+		if err != nil {
+			return "increment must be a number"
+		}
+		score, err := db.ZIncrBy(data[1], data[3], delta)
+		if err != nil {
+			return err
+		}
+		return score
+	case cmd == "zrem" && l >= 3:
+		return count(db.ZRem(data[1], data[2:]...))
+	case cmd == "zrange" && l == 4:
+		start, err1 := strconv.Atoi(data[2])
+		stop, err2 := strconv.Atoi(data[3])
+		if err1 != nil || err2 != nil {
+			return "start and stop must be numbers"
+		}
+		return scored(db.ZRange(data[1], start, stop))
+	case cmd == "zrangebyscore" && (l == 4 || l == 6):
+		min, err1 := strconv.ParseFloat(data[2], 64)
+		max, err2 := strconv.ParseFloat(data[3], 64)
+		if err1 != nil || err2 != nil {
+			return "min and max must be numbers, -inf or +inf"
+		}
+		limit := 0
+		if l == 6 {
+			n, err := strconv.Atoi(data[5])
+			if strings.ToLower(data[4]) != "limit" || err != nil || n < 0 {
+				return "usage: [zrangebyscore] [key] [min] [max] [limit n]"
+			}
+			limit = n
+		}
+		return scored(db.ZRangeByScore(data[1], min, max, limit))
+	case cmd == "zrank" && l == 3:
+		rank, _, err := db.ZRank(data[1], data[2])
+		if err != nil {
+			return err
+		}
+		return rank
+	case cmd == "zcard" && l == 2:
+		return count(db.ZCard(data[1]))
+	}
+
+	return "usage: [zadd key score member...] [zincrby key n member] [zrem key member...] [zrange key start stop] [zrangebyscore key min max [limit n]] [zrank key member] [zcard key]"
+}
+
+func scored(members []database.ZMember, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	res := make([]string, 0, len(members)*2)
+	for _, m := range members {
+		res = append(res, m.Member, strconv.FormatFloat(m.Score, 'g', -1, 64))
+	}
+	return strings.Join(res, " ")
+}